@@ -10,8 +10,6 @@ import (
 	"rag-sql/internal/graph"
 	"rag-sql/internal/llm"
 	"rag-sql/internal/tools"
-	"regexp"
-	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -26,9 +24,9 @@ func main() {
 	}
 
 	dbConn := db.Connect(cfg.DB)
-	schemaService := dbschema.NewService(dbConn)
+	schemaService := dbschema.NewService(dbConn, cfg.DB.Dialect, cfg.Schema, cfg.Policy)
 
-	tables := schemaService.ExtractTableNames()
+	tables := schemaService.ExtractTableNames(ctx)
 
 	llmClient := llm.New("llama3", "http://localhost:11434")
 
@@ -41,7 +39,7 @@ func main() {
 	for _, table := range tables {
 		fmt.Printf("\n🔍 Gerando aliases para: %s\n", table)
 
-		collumns, _ := schemaService.GetColumnsTable(table)
+		collumns, _ := schemaService.GetColumnsTable(ctx, table)
 		aliases, raw, err := tools.GenerateAliasesFromLLM(ctx, llmClient, table, collumns)
 		if err != nil {
 			fmt.Printf("❌ Erro para %s: %v\n", table, err)
@@ -63,19 +61,3 @@ func main() {
 	}
 
 }
-
-func ExtractTableNames(schema string) []string {
-	re := regexp.MustCompile(`(?i)create table "?(\w+)"?`)
-	matches := re.FindAllStringSubmatch(schema, -1)
-
-	var names []string
-	seen := map[string]bool{}
-	for _, m := range matches {
-		name := strings.ToLower(m[1])
-		if !seen[name] {
-			names = append(names, name)
-			seen[name] = true
-		}
-	}
-	return names
-}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"rag-sql/internal/config"
+	"rag-sql/internal/db"
+	"rag-sql/internal/db/dbschema"
+	"rag-sql/internal/graph"
+	"slices"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	fromRef := flag.String("from", "previous", `snapshot de origem: "latest", "previous", horário RFC 3339, ID ou "current"`)
+	toRef := flag.String("to", "latest", "snapshot de destino; \"current\" lê o schema do banco agora, sem guardá-lo")
+	save := flag.Bool("save", false, "lê o schema do banco e guarda no histórico antes de comparar")
+	asJSON := flag.Bool("json", false, "imprime o diff em JSON")
+	flagAliases := flag.Bool("flag-aliases", false, "marca no Neo4j os aliases de tabelas que não existem mais")
+	flag.Parse()
+
+	_ = godotenv.Load()
+	ctx := context.Background()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Erro ao carregar config:", err)
+	}
+
+	dbConn := db.Connect(cfg.DB)
+	schemaService := dbschema.NewService(dbConn, cfg.DB.Dialect, cfg.Schema, cfg.Policy)
+
+	if *save {
+		if err := saveSnapshot(ctx, schemaService); err != nil {
+			log.Fatalf("Erro ao guardar snapshot: %v", err)
+		}
+	}
+
+	from, err := loadSnapshot(ctx, schemaService, *fromRef)
+	if err != nil {
+		log.Fatalf("Erro ao carregar %s: %v", *fromRef, err)
+	}
+	to, err := loadSnapshot(ctx, schemaService, *toRef)
+	if err != nil {
+		log.Fatalf("Erro ao carregar %s: %v", *toRef, err)
+	}
+
+	diff := dbschema.Diff(from.Schema, to.Schema)
+	diff.From, diff.To = from.ID(), to.ID()
+
+	var stale []graph.EntityType
+	if *flagAliases {
+		if stale, err = flagStaleAliases(ctx, cfg, schemaService, diff.GoneTables()); err != nil {
+			log.Printf("⚠️ Erro ao marcar aliases obsoletos: %v", err)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		out := struct {
+			dbschema.SchemaDiff
+			StaleAliases []graph.EntityType `json:"stale_aliases,omitempty"`
+		}{diff, stale}
+		if err := enc.Encode(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printDiff(diff, stale)
+}
+
+// loadSnapshot lê "current" do banco e o resto do histórico.
+func loadSnapshot(ctx context.Context, schemaService *dbschema.Service, ref string) (*dbschema.Snapshot, error) {
+	if ref == "current" {
+		return schemaService.ReadSnapshot(ctx)
+	}
+	store, err := snapshotStore(schemaService)
+	if err != nil {
+		return nil, err
+	}
+	return store.Load(ref)
+}
+
+func saveSnapshot(ctx context.Context, schemaService *dbschema.Service) error {
+	store, err := snapshotStore(schemaService)
+	if err != nil {
+		return err
+	}
+	snap, err := schemaService.ReadSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	return store.Save(snap)
+}
+
+func snapshotStore(schemaService *dbschema.Service) (*dbschema.SnapshotStore, error) {
+	store := schemaService.Snapshots()
+	if store == nil {
+		return nil, fmt.Errorf("histórico de snapshots desligado; configure SCHEMA_SNAPSHOT_DIR")
+	}
+	return store, nil
+}
+
+// flagStaleAliases marca só as tabelas que também não existem no schema atual.
+func flagStaleAliases(ctx context.Context, cfg *config.Config, schemaService *dbschema.Service, gone []string) ([]graph.EntityType, error) {
+	if len(gone) == 0 {
+		return nil, nil
+	}
+	current, err := schemaService.ReadSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gone = slices.DeleteFunc(gone, current.Schema.HasTable)
+	if len(gone) == 0 {
+		return nil, nil
+	}
+
+	neo, err := graph.NewGraph(cfg.Neo4j.URI, cfg.Neo4j.User, cfg.Neo4j.Password)
+	if err != nil {
+		return nil, err
+	}
+	defer neo.Close(ctx)
+	return neo.FlagStaleAliases(ctx, gone)
+}
+
+func printDiff(diff dbschema.SchemaDiff, stale []graph.EntityType) {
+	fmt.Printf("📋 %s → %s\n", diff.From, diff.To)
+	if diff.Empty() {
+		fmt.Println("✅ Nenhuma mudança em tabelas, colunas ou FKs")
+	}
+
+	for _, t := range diff.AddedTables {
+		fmt.Printf("+ %s\n", t)
+	}
+	for _, t := range diff.RemovedTables {
+		fmt.Printf("- %s\n", t)
+	}
+	for _, r := range diff.RenamedTables {
+		fmt.Printf("~ %s → %s\n", r.From, r.To)
+	}
+
+	for _, td := range diff.ChangedTables {
+		fmt.Printf("\n%s\n", td.Table)
+		for _, c := range td.AddedColumns {
+			fmt.Printf("  + coluna %s\n", c)
+		}
+		for _, c := range td.RemovedColumns {
+			fmt.Printf("  - coluna %s\n", c)
+		}
+		for _, r := range td.RenamedColumns {
+			fmt.Printf("  ~ coluna %s → %s\n", r.From, r.To)
+		}
+		for _, tc := range td.TypeChanges {
+			fmt.Printf("  ~ coluna %s: %s → %s\n", tc.Column, tc.From, tc.To)
+		}
+		for _, fk := range td.AddedForeignKeys {
+			fmt.Printf("  + %s\n", fk)
+		}
+		for _, fk := range td.RemovedForeignKeys {
+			fmt.Printf("  - %s\n", fk)
+		}
+	}
+
+	if len(stale) > 0 {
+		fmt.Println("\n⚠️ Aliases marcados como obsoletos:")
+		for _, et := range stale {
+			fmt.Printf("  %s: %s\n", et.Name, strings.Join(et.Aliases, ", "))
+		}
+	}
+}
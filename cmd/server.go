@@ -4,12 +4,14 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"slices"
 
 	"rag-sql/internal/api"
 	"rag-sql/internal/config"
 	"rag-sql/internal/db"
 	"rag-sql/internal/db/contextbuilder"
 	"rag-sql/internal/db/dbschema"
+	"rag-sql/internal/db/dialect"
 	"rag-sql/internal/db/exec"
 	"rag-sql/internal/db/schemautil"
 	"rag-sql/internal/graph"
@@ -30,7 +32,8 @@ func main() {
 		log.Fatalf("erro ao carregar configuração: %v", err)
 	}
 
-	dbConn := db.Connect(cfg.DB)
+	cluster := db.NewCluster(cfg.DB)
+	go cluster.Watch(context.Background())
 
 	neoGraph, err := graph.NewGraph(cfg.Neo4j.URI, cfg.Neo4j.User, cfg.Neo4j.Password)
 	if err != nil {
@@ -38,25 +41,80 @@ func main() {
 	}
 	defer neoGraph.Close(context.Background())
 
-	schemaService := dbschema.NewService(dbConn)
+	schemaService := dbschema.NewService(cluster.Introspection(), cfg.DB.Dialect, cfg.Schema, cfg.Policy)
 	llmClient := llm.New("natural-sql-q4-k-s", "http://localhost:11434")
-	builder := contextbuilder.New(neoGraph)
+	builder := contextbuilder.New(neoGraph, cfg.DB.Dialect, schemaService)
 
-	executor := exec.New(dbConn)
+	executor := exec.New(cluster, cfg.DB.Dialect, cfg.Exec, cfg.Policy)
 
-	schemaStr, err := schemaService.GetAllAsString()
+	// views sobre tabelas com escopo não passam pela reescrita de tenant
+	if len(cfg.Exec.TenantScopes) > 0 {
+		deps, err := schemaService.ViewDependencies(context.Background())
+		if err != nil {
+			log.Fatalf("erro ao ler dependências das views: %v", err)
+		}
+		if views := executor.BlockUnscopedViews(deps); len(views) > 0 {
+			log.Fatalf("as views %v leem tabelas com escopo de tenant; configure EXEC_TENANT_SCOPES para elas ou oculte-as na política de schema", views)
+		}
+	}
+
+	schema, err := schemaService.Schema(context.Background())
 	if err != nil {
-		log.Fatalf("Erro ao obter schema como string: %v", err)
+		log.Fatalf("Erro ao obter schema: %v", err)
 	}
 
-	schemaGraph := schemautil.BuildSchemaGraph(schemaStr)
+	schemaGraph := schemautil.BuildSchemaGraph(schema)
 
 	err = neoGraph.LoadSchemaGraph(context.Background(), schemaGraph)
 	if err != nil {
 		log.Fatalf("Erro ao carregar schema no grafo: %v", err)
 	}
 
-	router := api.NewRouter(schemaService, builder, executor, llmClient)
+	schemaService.OnChange(executor.InvalidateTables)
+	if len(cfg.Exec.TenantScopes) > 0 {
+		// a cada releitura, já que trocar a consulta de uma view sem mudar as
+		// colunas não aparece como mudança no modelo
+		var blocked []string
+		schemaService.OnRefresh(func() {
+			deps, err := schemaService.ViewDependencies(context.Background())
+			if err != nil {
+				log.Printf("erro ao ler dependências das views: %v", err)
+				return
+			}
+			views := executor.BlockUnscopedViews(deps)
+			if len(views) > 0 && !slices.Equal(views, blocked) {
+				log.Printf("views bloqueadas por lerem tabelas com escopo de tenant: %v", views)
+			}
+			blocked = views
+		})
+	}
+	schemaService.OnChange(func(tables []string) {
+		schema, err := schemaService.Schema(context.Background())
+		if err == nil {
+			err = neoGraph.LoadSchemaGraph(context.Background(), schemautil.BuildSchemaGraph(schema))
+		}
+		if err != nil {
+			log.Printf("erro ao ressincronizar o grafo: %v", err)
+		}
+	})
+	go schemaService.Watch(context.Background(), cfg.Schema.WatchInterval)
+
+	if cfg.DB.Dialect == dialect.Postgres && cfg.Schema.NotifyChannel != "" {
+		if cfg.Schema.InstallEventTrigger {
+			if _, err := cluster.Primary().ExecContext(context.Background(), dbschema.EventTriggerSQL(cfg.Schema.NotifyChannel)); err != nil {
+				log.Fatalf("erro ao criar o event trigger de DDL: %v", err)
+			}
+		}
+		go func() {
+			// o aviso sai só do primário
+			if err := schemaService.ListenDDL(context.Background(), cfg.DB.ConnString(), cfg.Schema.NotifyChannel); err != nil {
+				log.Printf("escuta de DDL desligada: %v", err)
+			}
+		}()
+	}
+	go schemaService.WatchProfiles(context.Background(), cfg.Schema.ProfileInterval)
+
+	router := api.NewRouter(schemaService, builder, executor, llmClient, neoGraph, cfg.Ask)
 
 	log.Println("🚀 API rodando em http://localhost:8080")
 	http.ListenAndServe(":8080", router)
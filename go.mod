@@ -7,9 +7,37 @@ require (
 	github.com/lib/pq v1.10.9
 )
 
-require golang.org/x/text v0.9.0 // indirect
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	github.com/richardlehane/mscfb v1.0.4 // indirect
+	github.com/richardlehane/msoleps v1.0.4 // indirect
+	github.com/tiendc/go-deepcopy v1.6.0 // indirect
+	github.com/xuri/efp v0.0.1 // indirect
+	github.com/xuri/nfp v0.0.1 // indirect
+	golang.org/x/crypto v0.38.0 // indirect
+	golang.org/x/net v0.40.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.25.0 // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+)
 
 require (
+	github.com/go-sql-driver/mysql v1.8.1
 	github.com/lithammer/fuzzysearch v1.1.8
-	github.com/neo4j/neo4j-go-driver/v5 v5.28.1 // indirect
+	github.com/neo4j/neo4j-go-driver/v5 v5.28.1
+	github.com/parquet-go/parquet-go v0.25.1
+	github.com/pganalyze/pg_query_go/v6 v6.1.0
+	github.com/xuri/excelize/v2 v2.9.1
+	google.golang.org/protobuf v1.34.2
+	modernc.org/sqlite v1.34.5
 )
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"rag-sql/internal/db/exec"
+	"rag-sql/internal/export"
+	"strconv"
+)
+
+// requestedFormat lê o formato de exportação do parâmetro format ou, na
+// falta dele, do cabeçalho Accept. ok é falso quando a resposta deve ser o
+// JSON padrão.
+func requestedFormat(req *http.Request) (format export.Format, ok bool, err error) {
+	if name := req.URL.Query().Get("format"); name != "" && name != "json" {
+		format, ok = export.ByName(name)
+		if !ok {
+			return format, false, fmt.Errorf("formato de exportação desconhecido: %s", name)
+		}
+		return format, true, nil
+	}
+	if req.URL.Query().Get("format") == "json" {
+		return format, false, nil
+	}
+	format, ok = export.FromAccept(req.Header.Get("Accept"))
+	return format, ok, nil
+}
+
+// httpExport escreve os cabeçalhos HTTP só quando a primeira parte do
+// resultado chega, para que erros de validação e de plano ainda possam virar
+// uma resposta JSON normal.
+type httpExport struct {
+	w       http.ResponseWriter
+	format  export.Format
+	queryID string
+	inner   export.Writer
+}
+
+func (h *httpExport) WriteHeader(columns []exec.Column) error {
+	header := h.w.Header()
+	header.Set("Content-Type", h.format.ContentType)
+	header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="resultado-%s.%s"`, h.queryID, h.format.Extension))
+	header.Set("X-Query-Id", h.queryID)
+	// só dá para saber se o resultado foi truncado no fim, por isso vai
+	// como trailer
+	header.Set("Trailer", "X-Truncated")
+	h.w.WriteHeader(http.StatusOK)
+
+	h.inner = h.format.NewWriter(h.w)
+	return h.inner.WriteHeader(columns)
+}
+
+func (h *httpExport) WriteRow(row []any) error {
+	return h.inner.WriteRow(row)
+}
+
+// streamExport executa a consulta direto para a resposta. Devolve erro só
+// quando nada foi escrito; uma falha no meio do envio derruba a conexão para
+// que o cliente não receba um arquivo incompleto como se estivesse inteiro.
+func (r *RouterDeps) streamExport(ctx context.Context, w http.ResponseWriter, sql string, caller exec.Caller, format export.Format, queryID string) error {
+	ctx, cancel := withTimeout(ctx, r.Config.ExportTimeout)
+	defer cancel()
+
+	out := &httpExport{w: w, format: format, queryID: queryID}
+	summary, err := r.Executor.Stream(ctx, sql, caller, out)
+	if err == nil && out.inner != nil {
+		err = out.inner.Close()
+	}
+	if err != nil {
+		if out.inner == nil {
+			return err
+		}
+		log.Printf("erro durante exportação %s: %v", queryID, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	w.Header().Set("X-Truncated", strconv.FormatBool(summary.Truncated))
+	return nil
+}
+
+func (r *RouterDeps) handleDownload(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+	saved, ok := r.queries.get(id)
+	if !ok {
+		http.Error(w, "consulta não encontrada ou expirada", http.StatusNotFound)
+		return
+	}
+
+	format, ok, err := requestedFormat(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		format, _ = export.ByName("csv")
+	}
+
+	err = r.streamExport(req.Context(), w, saved.SQL, callerFromRequest(req), format, id)
+	if err == nil {
+		return
+	}
+
+	resp := askResponse{SQL: saved.SQL, QueryID: id, Data: "Erro ao executar SQL: " + err.Error()}
+	respondJSON(w, resp, r.errorStatus(req.Context(), err, &resp))
+}
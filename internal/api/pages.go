@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rag-sql/internal/db/exec"
+	"strconv"
+)
+
+// pageToken aponta para a próxima página de uma consulta guardada no
+// queryStore. Só o id vai no token; o SQL nunca sai do servidor.
+type pageToken struct {
+	QueryID string `json:"q"`
+	Offset  int    `json:"o"`
+	Size    int    `json:"s,omitempty"`
+}
+
+func (t pageToken) encode() string {
+	raw, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePageToken(s string) (pageToken, error) {
+	var t pageToken
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(raw, &t)
+	}
+	if err != nil || t.QueryID == "" || t.Offset < 0 || t.Size < 0 {
+		return t, errors.New("page_token inválido")
+	}
+	return t, nil
+}
+
+// requestedPage lê page_size, count e page_token. token é nil na primeira
+// página.
+func requestedPage(req *http.Request) (page exec.Page, token *pageToken, err error) {
+	query := req.URL.Query()
+
+	if size := query.Get("page_size"); size != "" {
+		if page.Size, err = strconv.Atoi(size); err != nil || page.Size <= 0 {
+			return page, nil, fmt.Errorf("page_size inválido: %s", size)
+		}
+	}
+
+	switch page.Count = query.Get("count"); page.Count {
+	case "", exec.CountExact, exec.CountEstimate:
+	default:
+		return page, nil, fmt.Errorf("count inválido: %s (use %s ou %s)", page.Count, exec.CountExact, exec.CountEstimate)
+	}
+
+	if raw := query.Get("page_token"); raw != "" {
+		t, err := decodePageToken(raw)
+		if err != nil {
+			return page, nil, err
+		}
+		page.Offset = t.Offset
+		if page.Size == 0 {
+			page.Size = t.Size
+		}
+		token = &t
+	}
+	return page, token, nil
+}
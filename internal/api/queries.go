@@ -0,0 +1,70 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// queryStore guarda o SQL das consultas respondidas para que o resultado
+// possa ser baixado depois pelo id. Só o SQL é guardado; o download executa
+// de novo com o papel e o tenant de quem pede.
+type queryStore struct {
+	ttl time.Duration
+	max int
+
+	mu    sync.Mutex
+	items map[string]savedQuery
+	order []string
+}
+
+type savedQuery struct {
+	SQL       string
+	CreatedAt time.Time
+}
+
+func newQueryStore(ttl time.Duration, max int) *queryStore {
+	return &queryStore{ttl: ttl, max: max, items: map[string]savedQuery{}}
+}
+
+func (s *queryStore) save(sql string) string {
+	var b [16]byte
+	rand.Read(b[:])
+	id := hex.EncodeToString(b[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[id] = savedQuery{SQL: sql, CreatedAt: time.Now()}
+	s.order = append(s.order, id)
+
+	// a ordem de inserção é a de expiração, então basta olhar o início
+	for len(s.order) > 0 {
+		oldest := s.order[0]
+		q, ok := s.items[oldest]
+		if ok && len(s.items) <= s.max && time.Since(q.CreatedAt) <= s.ttl {
+			break
+		}
+		delete(s.items, oldest)
+		s.order = s.order[1:]
+	}
+	return id
+}
+
+func (s *queryStore) get(id string) (savedQuery, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.items[id]
+	if !ok || time.Since(q.CreatedAt) > s.ttl {
+		return savedQuery{}, false
+	}
+	return q, true
+}
+
+func (s *queryStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+}
@@ -1,15 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"rag-sql/internal/config"
 	"rag-sql/internal/db/contextbuilder"
 	"rag-sql/internal/db/dbschema"
 	"rag-sql/internal/db/exec"
+	"rag-sql/internal/graph"
 	"rag-sql/internal/llm"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type RouterDeps struct {
@@ -17,78 +24,352 @@ type RouterDeps struct {
 	Builder       *contextbuilder.Builder
 	Executor      *exec.Executor
 	LLM           *llm.Client
+	Graph         *graph.Neo4jGraph
+	Config        config.AskConfig
+
+	queries *queryStore
 }
 
-func NewRouter(schemaService *dbschema.Service, builder *contextbuilder.Builder, executor *exec.Executor, llmClient *llm.Client) http.Handler {
+func NewRouter(schemaService *dbschema.Service, builder *contextbuilder.Builder, executor *exec.Executor, llmClient *llm.Client, neoGraph *graph.Neo4jGraph, cfg config.AskConfig) http.Handler {
 	mux := http.NewServeMux()
-	deps := &RouterDeps{schemaService, builder, executor, llmClient}
+	deps := &RouterDeps{
+		SchemaService: schemaService,
+		Builder:       builder,
+		Executor:      executor,
+		LLM:           llmClient,
+		Graph:         neoGraph,
+		Config:        cfg,
+		queries:       newQueryStore(cfg.QueryTTL, cfg.MaxSavedQueries),
+	}
 
 	mux.HandleFunc("/api/ask", deps.handleAsk)
 	mux.HandleFunc("/api/schema", deps.handleSchema)
+	mux.HandleFunc("GET /api/schema/diff", deps.handleSchemaDiff)
+	mux.HandleFunc("POST /api/schema/diff/apply", deps.handleSchemaDiffApply)
+	mux.HandleFunc("GET /api/queries/{id}/download", deps.handleDownload)
 
 	return mux
 }
 
 type askResponse struct {
-	SQL  string      `json:"sql"`
-	Data interface{} `json:"data"`
+	SQL       string        `json:"sql"`
+	QueryID   string        `json:"query_id,omitempty"`
+	Columns   []exec.Column `json:"columns,omitempty"`
+	Data      interface{}   `json:"data"`
+	Truncated bool          `json:"truncated"`
+	// NextPageToken é enviado só quando há mais linhas.
+	NextPageToken      string            `json:"next_page_token,omitempty"`
+	TotalRows          *int64            `json:"total_rows,omitempty"`
+	TotalRowsEstimated bool              `json:"total_rows_estimated,omitempty"`
+	Plan               *exec.PlanSummary `json:"plan,omitempty"`
+	Rejections         []exec.Rejection  `json:"rejections,omitempty"`
 }
 
 func (r *RouterDeps) handleAsk(w http.ResponseWriter, req *http.Request) {
+	format, exporting, err := requestedFormat(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, token, err := requestedPage(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := withTimeout(req.Context(), r.Config.Timeout)
+	defer cancel()
+
+	if token != nil {
+		if exporting {
+			http.Error(w, "page_token não se aplica à exportação; use /api/queries/{id}/download", http.StatusBadRequest)
+			return
+		}
+		r.respondNextPage(ctx, w, req, *token, page)
+		return
+	}
+
 	q := req.URL.Query().Get("q")
 	if q == "" {
 		http.Error(w, "missing query", http.StatusBadRequest)
 		return
 	}
 
-	schema, err := r.SchemaService.GetCreateTableStatements()
+	schema, err := r.loadSchema(ctx)
 	if err != nil {
-		http.Error(w, "erro ao extrair schema: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "erro ao extrair schema: "+err.Error(), statusFor(ctx, err))
 		return
 	}
 
-	prompt := r.Builder.BuildPrompt(schema, q, nil, "")
+	prompt, tables := r.buildPrompt(ctx, schema, q, "")
 
 	println("Prompt para LLM:", prompt)
 
-	sql, err := r.LLM.GenerateSQL(prompt)
+	sql, err := r.generateSQL(ctx, prompt)
 	if err != nil {
-		http.Error(w, "erro ao gerar SQL: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "erro ao gerar SQL: "+err.Error(), statusFor(ctx, err))
+		return
+	}
+
+	caller := callerFromRequest(req)
+
+	if dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dry_run")); dryRun {
+		r.respondDryRun(ctx, w, sql, prompt, tables, caller)
 		return
 	}
 
-	data, execErr := r.Executor.Execute(sql)
+	respond := func(ctx context.Context, w http.ResponseWriter, sql string, caller exec.Caller) error {
+		return r.respondJSONResult(ctx, w, sql, caller, page, "")
+	}
+	if exporting {
+		respond = func(ctx context.Context, w http.ResponseWriter, sql string, caller exec.Caller) error {
+			id := r.queries.save(sql)
+			err := r.streamExport(ctx, w, sql, caller, format, id)
+			if err != nil {
+				r.queries.delete(id)
+			}
+			return err
+		}
+	}
+
+	execErr := respond(ctx, w, sql, caller)
 	if execErr == nil {
-		respondJSON(w, askResponse{SQL: sql, Data: data})
 		return
 	}
 
 	log.Printf("Erro ao executar SQL: %v", execErr)
+	if ctx.Err() != nil {
+		respondJSON(w, askResponse{SQL: sql, Data: "Requisição cancelada: " + ctx.Err().Error()}, statusFor(ctx, execErr))
+		return
+	}
+
 	suggestion := analyzeSQLError(execErr.Error())
-	promptRetry := r.Builder.BuildPrompt(schema, q, nil, suggestion)
 
-	sqlRetry, err := r.LLM.GenerateSQL(promptRetry)
+	var budgetErr *exec.BudgetError
+	if errors.As(execErr, &budgetErr) {
+		suggestion = planSuggestion(budgetErr.Plan)
+	}
+	promptRetry, _ := r.buildPrompt(ctx, schema, q, suggestion)
+
+	sqlRetry, err := r.generateSQL(ctx, promptRetry)
+	if err != nil {
+		respondJSON(w, askResponse{SQL: sql, Data: "Erro ao gerar SQL na segunda tentativa: " + err.Error()}, statusFor(ctx, err))
+		return
+	}
+
+	if execErr = respond(ctx, w, sqlRetry, caller); execErr != nil {
+		resp := askResponse{SQL: sqlRetry, Data: "Erro ao executar SQL na segunda tentativa: " + execErr.Error()}
+		respondJSON(w, resp, r.errorStatus(ctx, execErr, &resp))
+	}
+}
+
+// respondJSONResult executa uma página da consulta e responde em JSON.
+// Devolve o erro sem escrever nada para que a chamada possa tentar de novo.
+// Sem queryID a consulta é guardada com um id novo.
+func (r *RouterDeps) respondJSONResult(ctx context.Context, w http.ResponseWriter, sql string, caller exec.Caller, page exec.Page, queryID string) error {
+	result, err := r.execute(ctx, sql, caller, page)
 	if err != nil {
-		respondJSON(w, askResponse{SQL: sql, Data: "Erro ao gerar SQL na segunda tentativa: " + err.Error()}, http.StatusInternalServerError)
+		return err
+	}
+
+	if queryID == "" {
+		queryID = r.queries.save(sql)
+	}
+	resp := askResponse{
+		SQL:                sql,
+		QueryID:            queryID,
+		Columns:            result.Columns,
+		Data:               result.Rows,
+		Truncated:          result.Truncated,
+		TotalRows:          result.TotalRows,
+		TotalRowsEstimated: result.TotalRowsEstimated,
+		Plan:               result.Plan,
+	}
+	if result.NextOffset > 0 {
+		resp.NextPageToken = pageToken{QueryID: queryID, Offset: result.NextOffset, Size: page.Size}.encode()
+	}
+
+	setCacheHeaders(w, result)
+	respondJSON(w, resp)
+	return nil
+}
+
+// respondNextPage executa de novo a consulta guardada, sem passar pelo LLM,
+// com o papel e o tenant de quem pede a página.
+func (r *RouterDeps) respondNextPage(ctx context.Context, w http.ResponseWriter, req *http.Request, token pageToken, page exec.Page) {
+	saved, ok := r.queries.get(token.QueryID)
+	if !ok {
+		http.Error(w, "consulta não encontrada ou expirada", http.StatusNotFound)
+		return
+	}
+
+	err := r.respondJSONResult(ctx, w, saved.SQL, callerFromRequest(req), page, token.QueryID)
+	if err == nil {
 		return
 	}
 
-	dataRetry, execErr := r.Executor.Execute(sqlRetry)
-	if execErr != nil {
-		respondJSON(w, askResponse{SQL: sqlRetry, Data: "Erro ao executar SQL na segunda tentativa: " + execErr.Error()}, http.StatusInternalServerError)
+	log.Printf("Erro ao executar SQL: %v", err)
+	resp := askResponse{SQL: saved.SQL, QueryID: token.QueryID, Data: "Erro ao executar SQL: " + err.Error()}
+	respondJSON(w, resp, r.errorStatus(ctx, err, &resp))
+}
+
+// errorStatus preenche as rejeições e o plano do erro na resposta e escolhe
+// o status: 422 para consultas recusadas, o de statusFor para o resto.
+func (r *RouterDeps) errorStatus(ctx context.Context, err error, resp *askResponse) int {
+	status := statusFor(ctx, err)
+
+	var validationErr *exec.ValidationError
+	if errors.As(err, &validationErr) {
+		resp.Rejections = validationErr.Rejections
+		status = http.StatusUnprocessableEntity
+	}
+	var budgetErr *exec.BudgetError
+	if errors.As(err, &budgetErr) {
+		resp.Plan = budgetErr.Plan
+		status = http.StatusUnprocessableEntity
+	}
+	return status
+}
+
+type dryRunResponse struct {
+	SQL         string            `json:"sql"`
+	Tables      []string          `json:"tables"`
+	PromptChars int               `json:"prompt_chars"`
+	Plan        *exec.PlanSummary `json:"plan,omitempty"`
+	Rejections  []exec.Rejection  `json:"rejections,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// respondDryRun valida a consulta e roda apenas o EXPLAIN, sem tocar nos dados.
+func (r *RouterDeps) respondDryRun(ctx context.Context, w http.ResponseWriter, sql, prompt string, tables []string, caller exec.Caller) {
+	resp := dryRunResponse{SQL: sql, Tables: tables, PromptChars: len(prompt)}
+
+	explainCtx, cancel := withTimeout(ctx, r.Config.ExecTimeout)
+	defer cancel()
+
+	plan, err := r.Executor.Explain(explainCtx, sql, caller)
+	if err == nil {
+		resp.Plan = plan
+		respondJSON(w, resp)
 		return
 	}
 
-	respondJSON(w, askResponse{SQL: sqlRetry, Data: dataRetry})
+	resp.Error = err.Error()
+	status := statusFor(ctx, err)
+
+	var validationErr *exec.ValidationError
+	if errors.As(err, &validationErr) {
+		resp.Rejections = validationErr.Rejections
+		status = http.StatusUnprocessableEntity
+	}
+	respondJSON(w, resp, status)
+}
+
+func (r *RouterDeps) loadSchema(ctx context.Context) (*dbschema.Schema, error) {
+	ctx, cancel := withTimeout(ctx, r.Config.RetrievalTimeout)
+	defer cancel()
+	return r.SchemaService.Schema(ctx)
+}
+
+func (r *RouterDeps) buildPrompt(ctx context.Context, schema *dbschema.Schema, question, lastError string) (string, []string) {
+	ctx, cancel := withTimeout(ctx, r.Config.RetrievalTimeout)
+	defer cancel()
+	return r.Builder.BuildPrompt(ctx, schema, question, nil, lastError)
+}
+
+func (r *RouterDeps) generateSQL(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := withTimeout(ctx, r.Config.LLMTimeout)
+	defer cancel()
+	return r.LLM.GenerateSQL(ctx, prompt)
+}
+
+func (r *RouterDeps) execute(ctx context.Context, sql string, caller exec.Caller, page exec.Page) (*exec.Result, error) {
+	ctx, cancel := withTimeout(ctx, r.Config.ExecTimeout)
+	defer cancel()
+	return r.Executor.ExecutePage(ctx, sql, caller, page)
+}
+
+// setCacheHeaders informa se o resultado veio do cache (X-Cache) e há
+// quantos segundos ele foi gerado (Age).
+func setCacheHeaders(w http.ResponseWriter, result *exec.Result) {
+	switch result.CacheStatus {
+	case exec.CacheHit:
+		w.Header().Set("X-Cache", "HIT")
+		w.Header().Set("Age", strconv.Itoa(int(time.Since(result.CachedAt).Seconds())))
+	case exec.CacheMiss:
+		w.Header().Set("X-Cache", "MISS")
+		w.Header().Set("Age", "0")
+	}
 }
 
+// callerFromRequest lê o papel (X-Role) e os atributos de tenant dos
+// cabeçalhos X-Tenant-*, que devem ser preenchidos pelo proxy de
+// autenticação à frente da API. X-Tenant-Company-Id vira o atributo
+// company_id.
+func callerFromRequest(req *http.Request) exec.Caller {
+	caller := exec.Caller{
+		Role:       req.Header.Get("X-Role"),
+		Attributes: map[string]string{},
+	}
+	for key, values := range req.Header {
+		attr, ok := strings.CutPrefix(key, "X-Tenant-")
+		if !ok || len(values) == 0 {
+			continue
+		}
+		attr = strings.ToLower(strings.ReplaceAll(attr, "-", "_"))
+		caller.Attributes[attr] = values[0]
+	}
+	return caller
+}
+
+// handleSchema devolve o schema como DDL ou, com format=json ou Accept:
+// application/json, o modelo estruturado. O ETag vem do hash do snapshot.
 func (r *RouterDeps) handleSchema(w http.ResponseWriter, req *http.Request) {
-	schema, err := r.SchemaService.GetCreateTableStatements()
+	snap, err := r.SchemaService.Snapshot(req.Context())
 	if err != nil {
 		http.Error(w, "erro ao extrair schema: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Write([]byte(schema))
+
+	format := req.URL.Query().Get("format")
+	asJSON := format == "json" || (format == "" && strings.Contains(req.Header.Get("Accept"), "application/json"))
+
+	// o corpo muda com o formato, e o ETag também
+	etag := `"` + snap.Hash[:16] + `-ddl"`
+	if asJSON {
+		etag = `"` + snap.Hash[:16] + `-json"`
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Vary", "Accept")
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if asJSON {
+		respondJSON(w, snap.Schema)
+		return
+	}
+	w.Write([]byte(dbschema.RenderDDL(snap.Schema)))
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func statusFor(ctx context.Context, err error) int {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+		// o cliente desconectou; o status é só para o log do servidor
+		return 499
+	}
+	return http.StatusInternalServerError
 }
 
 func analyzeSQLError(err string) string {
@@ -114,6 +395,16 @@ func analyzeSQLError(err string) string {
 	return err
 }
 
+func planSuggestion(plan *exec.PlanSummary) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "A consulta anterior foi rejeitada por ser cara demais (custo estimado %.0f, %.0f linhas estimadas).\n", plan.TotalCost, plan.EstimatedRows)
+	for _, v := range plan.Violations {
+		sb.WriteString("- " + v + "\n")
+	}
+	sb.WriteString("Junte as tabelas pelas chaves estrangeiras, evite produtos cartesianos e adicione filtros seletivos.")
+	return sb.String()
+}
+
 func respondJSON(w http.ResponseWriter, payload interface{}, opt ...interface{}) {
 	if len(opt) > 0 {
 		if status, ok := opt[0].(int); ok {
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"rag-sql/internal/db/dbschema"
+	"slices"
+)
+
+type schemaDiffResponse struct {
+	dbschema.SchemaDiff
+	// StaleAliases são as tabelas que sumiram do schema atual mas ainda têm
+	// aliases no grafo; só vêm no POST, que as marca como obsoletas.
+	StaleAliases []staleAlias `json:"stale_aliases,omitempty"`
+}
+
+type staleAlias struct {
+	Table   string   `json:"table"`
+	Aliases []string `json:"aliases"`
+}
+
+// handleSchemaDiff compara dois snapshots do histórico. from e to aceitam
+// "latest", "previous", um horário RFC 3339, o ID do snapshot ou "current",
+// o schema em uso agora; o padrão é from=previous e to=latest. Só lê: o
+// grafo é atualizado por handleSchemaDiffApply.
+func (r *RouterDeps) handleSchemaDiff(w http.ResponseWriter, req *http.Request) {
+	diff, ok := r.schemaDiff(w, req)
+	if !ok {
+		return
+	}
+	respondJSON(w, schemaDiffResponse{SchemaDiff: diff})
+}
+
+// handleSchemaDiffApply calcula o mesmo diff e marca no grafo os aliases das
+// tabelas que não existem mais.
+func (r *RouterDeps) handleSchemaDiffApply(w http.ResponseWriter, req *http.Request) {
+	diff, ok := r.schemaDiff(w, req)
+	if !ok {
+		return
+	}
+	resp := schemaDiffResponse{SchemaDiff: diff}
+
+	stale, err := r.flagStaleAliases(req.Context(), diff.GoneTables())
+	if err != nil {
+		http.Error(w, "erro ao marcar aliases obsoletos: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.StaleAliases = stale
+
+	respondJSON(w, resp)
+}
+
+func (r *RouterDeps) schemaDiff(w http.ResponseWriter, req *http.Request) (dbschema.SchemaDiff, bool) {
+	ctx := req.Context()
+	query := req.URL.Query()
+
+	fromRef := query.Get("from")
+	if fromRef == "" {
+		fromRef = "previous"
+	}
+	from, err := r.resolveSnapshot(ctx, fromRef)
+	if err != nil {
+		respondSnapshotError(w, err)
+		return dbschema.SchemaDiff{}, false
+	}
+	to, err := r.resolveSnapshot(ctx, query.Get("to"))
+	if err != nil {
+		respondSnapshotError(w, err)
+		return dbschema.SchemaDiff{}, false
+	}
+
+	diff := dbschema.Diff(from.Schema, to.Schema)
+	diff.From, diff.To = from.ID(), to.ID()
+	return diff, true
+}
+
+func (r *RouterDeps) resolveSnapshot(ctx context.Context, ref string) (*dbschema.Snapshot, error) {
+	if ref == "current" {
+		return r.SchemaService.Snapshot(ctx)
+	}
+	store := r.SchemaService.Snapshots()
+	if store == nil {
+		return nil, errSnapshotsDisabled
+	}
+	return store.Load(ref)
+}
+
+var errSnapshotsDisabled = errors.New("histórico de snapshots desligado; configure SCHEMA_SNAPSHOT_DIR")
+
+func respondSnapshotError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, dbschema.ErrSnapshotNotFound) || errors.Is(err, errSnapshotsDisabled) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// flagStaleAliases marca no grafo as tabelas do diff que também não existem
+// no schema atual; num diff entre snapshots antigos a tabela pode ter voltado.
+func (r *RouterDeps) flagStaleAliases(ctx context.Context, gone []string) ([]staleAlias, error) {
+	if r.Graph == nil || len(gone) == 0 {
+		return nil, nil
+	}
+	current, err := r.SchemaService.Schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gone = slices.DeleteFunc(gone, current.HasTable)
+	if len(gone) == 0 {
+		return nil, nil
+	}
+
+	entities, err := r.Graph.FlagStaleAliases(ctx, gone)
+	if err != nil {
+		return nil, err
+	}
+	stale := make([]staleAlias, len(entities))
+	for i, et := range entities {
+		stale[i] = staleAlias{Table: et.Name, Aliases: et.Aliases}
+	}
+	return stale, nil
+}
@@ -1,13 +1,59 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"rag-sql/internal/db/dialect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	DB    DatabaseConfig
-	Neo4j Neo4jConfig
+	DB     DatabaseConfig
+	Neo4j  Neo4jConfig
+	Exec   ExecConfig
+	Ask    AskConfig
+	Policy SchemaPolicy
+	Schema SchemaConfig
+}
+
+type SchemaConfig struct {
+	// WatchInterval é o intervalo entre verificações de mudança de schema;
+	// zero desliga a verificação periódica.
+	WatchInterval time.Duration
+	// NotifyChannel é o canal LISTEN/NOTIFY em que o event trigger do
+	// Postgres avisa de DDL; vazio desliga a escuta. InstallEventTrigger cria
+	// o event trigger na partida, o que exige superusuário.
+	NotifyChannel       string
+	InstallEventTrigger bool
+	// Schemas são os schemas introspectados (no MySQL, os bancos); vazio
+	// usa o padrão do dialeto.
+	Schemas []string
+	// ViewDefinitions inclui o SELECT das views no schema enviado ao LLM.
+	ViewDefinitions bool
+	// SnapshotDir é o diretório onde cada versão do schema é guardada para
+	// comparação; vazio desliga o histórico.
+	SnapshotDir string
+
+	// ProfileInterval é o intervalo entre as coletas de valores das colunas;
+	// zero desliga a coleta.
+	ProfileInterval time.Duration
+	// ProfileMaxValues é o máximo de valores distintos para uma coluna de
+	// texto ser listada; ProfileSampleRows é o tamanho aproximado da amostra.
+	ProfileMaxValues  int
+	ProfileSampleRows int
+	// ProfileExclude lista tabelas ("tabela") e colunas ("tabela.coluna" ou
+	// "*.coluna") cujos valores não vão para o prompt. Colunas mascaradas e
+	// tabelas com escopo de tenant entram na lista automaticamente.
+	ProfileExclude []string
+	// ProfileExcludeSemantic lista os tipos semânticos ("email", "cpf",
+	// "phone") mascarados em alguma política; colunas desses tipos também
+	// ficam sem valores.
+	ProfileExcludeSemantic []string
 }
 
 type Neo4jConfig struct {
@@ -17,40 +63,298 @@ type Neo4jConfig struct {
 }
 
 type DatabaseConfig struct {
+	Dialect  string
+	Path     string
 	Host     string
 	Port     string
 	User     string
 	Password string
 	Name     string
 	SSLMode  string
+
+	// Replicas são endereços host[:porta] de réplicas de leitura, com as
+	// mesmas credenciais do primário.
+	Replicas             []string
+	ReplicaMaxLag        time.Duration
+	ReplicaCheckInterval time.Duration
+	// IntrospectPrimary faz a leitura do schema ir sempre ao primário.
+	IntrospectPrimary bool
+}
+
+type ExecConfig struct {
+	DeniedFunctions          []string
+	StatementTimeout         time.Duration
+	LockTimeout              time.Duration
+	IdleInTransactionTimeout time.Duration
+	MaxRows                  int
+	// DefaultLimit é o LIMIT posto nos SELECTs que não têm um; zero desliga.
+	DefaultLimit        int
+	ExportMaxRows       int
+	MaxPlanCost         float64
+	MaxPlanRows         float64
+	SeqScanMaxTableRows float64
+	TenantScopes        map[string]TenantScope
+	Masking             MaskingConfig
+	Cache               CacheConfig
+}
+
+// CacheConfig limita o cache de resultados; TTL ou MaxBytes zero desligam o
+// cache.
+type CacheConfig struct {
+	TTL      time.Duration
+	MaxBytes int64
+}
+
+// TenantScope define a coluna que restringe uma tabela e o atributo do
+// chamador que fornece o valor do filtro.
+type TenantScope struct {
+	Column    string
+	Attribute string
+}
+
+var defaultDeniedFunctions = []string{
+	"pg_sleep", "pg_sleep_for", "pg_sleep_until",
+	"dblink", "dblink_exec", "dblink_connect", "dblink_send_query",
+	"pg_read_file", "pg_read_binary_file", "pg_ls_dir", "pg_stat_file",
+	"lo_import", "lo_export", "lo_get", "lo_put",
+	"pg_terminate_backend", "pg_cancel_backend", "pg_reload_conf", "pg_rotate_logfile",
+	"pg_advisory_lock", "pg_advisory_xact_lock", "pg_try_advisory_lock",
+	"set_config", "nextval", "setval", "copy_to_program",
+	// leem tabelas ou consultas passadas como texto, fora do alcance das
+	// reescritas e checagens feitas na árvore
+	"query_to_xml", "query_to_xmlschema", "query_to_xml_and_xmlschema",
+	"table_to_xml", "table_to_xmlschema", "table_to_xml_and_xmlschema",
+	"cursor_to_xml", "cursor_to_xmlschema",
+	"schema_to_xml", "schema_to_xmlschema", "schema_to_xml_and_xmlschema",
+	"database_to_xml", "database_to_xmlschema", "database_to_xml_and_xmlschema",
+	"ts_stat",
+	"load_extension", "readfile", "writefile", "edit", "fts3_tokenizer",
+	"sleep", "benchmark", "load_file", "get_lock", "release_lock", "release_all_locks",
+	"sys_exec", "sys_eval",
+}
+
+type AskConfig struct {
+	Timeout          time.Duration
+	RetrievalTimeout time.Duration
+	LLMTimeout       time.Duration
+	ExecTimeout      time.Duration
+	ExportTimeout    time.Duration
+	// QueryTTL e MaxSavedQueries limitam as consultas guardadas para
+	// download posterior.
+	QueryTTL        time.Duration
+	MaxSavedQueries int
+}
+
+type MaskingPolicy struct {
+	// Columns usa chaves "schema.tabela.coluna", "tabela.coluna" (em qualquer
+	// schema) ou "*.coluna".
+	Columns       map[string]string `json:"columns"`
+	SemanticTypes map[string]string `json:"semantic_types"`
+}
+
+type MaskingConfig struct {
+	Default  MaskingPolicy            `json:"default"`
+	Roles    map[string]MaskingPolicy `json:"roles"`
+	HashSalt string                   `json:"-"`
 }
 
+var maskingStrategies = map[string]bool{"redact": true, "hash": true, "partial": true, "drop": true}
+
 func Load() (*Config, error) {
+	dialectName := getenv("DB_DIALECT", dialect.Postgres)
 	db := DatabaseConfig{
+		Dialect:  dialectName,
+		Path:     getenv("DB_PATH", ""),
 		Host:     getenv("DB_HOST", "localhost"),
-		Port:     getenv("DB_PORT", "5432"),
+		Port:     getenv("DB_PORT", dialect.DefaultPort(dialectName)),
 		User:     getenv("DB_USER", "postgres"),
 		Password: getenv("DB_PASSWORD", "postgres"),
 		Name:     getenv("DB_NAME", "postgres"),
 		SSLMode:  getenv("DB_SSLMODE", "disable"),
 	}
 
+	if err := dialect.Validate(db.Dialect); err != nil {
+		return nil, err
+	}
+
+	var err error
+	db.Replicas = getenvList("DB_REPLICAS", nil)
+	if db.ReplicaMaxLag, err = getenvDuration("DB_REPLICA_MAX_LAG", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if db.ReplicaCheckInterval, err = getenvDuration("DB_REPLICA_CHECK_INTERVAL", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if db.IntrospectPrimary, err = getenvBool("DB_INTROSPECT_PRIMARY", true); err != nil {
+		return nil, err
+	}
+
 	neo4j := Neo4jConfig{
 		URI:      getenv("NEO4J_URI", "bolt://localhost:7687"),
 		User:     getenv("NEO4J_USER", "neo4j"),
 		Password: getenv("NEO4J_PASSWORD", "your_password"),
 	}
 
-	return &Config{DB: db, Neo4j: neo4j}, nil
+	exec := ExecConfig{
+		DeniedFunctions: getenvList("EXEC_DENIED_FUNCTIONS", defaultDeniedFunctions),
+	}
+
+	if exec.TenantScopes, err = parseTenantScopes(os.Getenv("EXEC_TENANT_SCOPES")); err != nil {
+		return nil, err
+	}
+	if exec.Masking, err = loadMasking(os.Getenv("MASKING_POLICY_FILE")); err != nil {
+		return nil, err
+	}
+	exec.Masking.HashSalt = os.Getenv("MASKING_HASH_SALT")
+	if exec.Masking.HashSalt == "" && exec.Masking.usesStrategy("hash") {
+		// sem sal, CPFs e emails com hash saem por dicionário
+		return nil, fmt.Errorf("MASKING_HASH_SALT é obrigatório quando a estratégia hash está configurada")
+	}
+	if exec.StatementTimeout, err = getenvDuration("EXEC_STATEMENT_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if exec.LockTimeout, err = getenvDuration("EXEC_LOCK_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if exec.IdleInTransactionTimeout, err = getenvDuration("EXEC_IDLE_IN_TRANSACTION_TIMEOUT", 60*time.Second); err != nil {
+		return nil, err
+	}
+	if exec.MaxRows, err = getenvInt("EXEC_MAX_ROWS", 1000); err != nil {
+		return nil, err
+	}
+	if exec.DefaultLimit, err = getenvInt("EXEC_DEFAULT_LIMIT", 1000); err != nil {
+		return nil, err
+	}
+	if exec.ExportMaxRows, err = getenvInt("EXEC_EXPORT_MAX_ROWS", 1_000_000); err != nil {
+		return nil, err
+	}
+	if exec.MaxPlanCost, err = getenvFloat("EXEC_MAX_PLAN_COST", 1_000_000); err != nil {
+		return nil, err
+	}
+	if exec.MaxPlanRows, err = getenvFloat("EXEC_MAX_PLAN_ROWS", 10_000_000); err != nil {
+		return nil, err
+	}
+	if exec.SeqScanMaxTableRows, err = getenvFloat("EXEC_SEQ_SCAN_MAX_TABLE_ROWS", 5_000_000); err != nil {
+		return nil, err
+	}
+	if exec.Cache.TTL, err = getenvDuration("CACHE_TTL", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	cacheMaxBytes, err := getenvInt("CACHE_MAX_BYTES", 64<<20)
+	if err != nil {
+		return nil, err
+	}
+	exec.Cache.MaxBytes = int64(cacheMaxBytes)
+
+	var ask AskConfig
+	if ask.Timeout, err = getenvDuration("ASK_TIMEOUT", 3*time.Minute); err != nil {
+		return nil, err
+	}
+	if ask.RetrievalTimeout, err = getenvDuration("ASK_RETRIEVAL_TIMEOUT", 15*time.Second); err != nil {
+		return nil, err
+	}
+	if ask.LLMTimeout, err = getenvDuration("ASK_LLM_TIMEOUT", 90*time.Second); err != nil {
+		return nil, err
+	}
+	if ask.ExecTimeout, err = getenvDuration("ASK_EXEC_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if ask.ExportTimeout, err = getenvDuration("ASK_EXPORT_TIMEOUT", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if ask.QueryTTL, err = getenvDuration("ASK_QUERY_TTL", time.Hour); err != nil {
+		return nil, err
+	}
+	if ask.MaxSavedQueries, err = getenvInt("ASK_MAX_SAVED_QUERIES", 1000); err != nil {
+		return nil, err
+	}
+	// a paginação e o download dependem da consulta guardada, então não há
+	// como desligar o armazenamento
+	if ask.QueryTTL <= 0 {
+		return nil, fmt.Errorf("ASK_QUERY_TTL deve ser positivo: %s", ask.QueryTTL)
+	}
+	if ask.MaxSavedQueries < 1 {
+		return nil, fmt.Errorf("ASK_MAX_SAVED_QUERIES deve ser pelo menos 1: %d", ask.MaxSavedQueries)
+	}
+
+	var policy SchemaPolicy
+	if err := loadJSONFile(os.Getenv("SCHEMA_POLICY_FILE"), &policy); err != nil {
+		return nil, fmt.Errorf("erro ao carregar política de schema: %w", err)
+	}
+
+	var schema SchemaConfig
+	if schema.WatchInterval, err = getenvDuration("SCHEMA_WATCH_INTERVAL", time.Minute); err != nil {
+		return nil, err
+	}
+	schema.Schemas = getenvList("DB_SCHEMAS", nil)
+	schema.NotifyChannel = getenv("SCHEMA_NOTIFY_CHANNEL", "")
+	if schema.InstallEventTrigger, err = getenvBool("SCHEMA_INSTALL_EVENT_TRIGGER", false); err != nil {
+		return nil, err
+	}
+	schema.SnapshotDir = getenv("SCHEMA_SNAPSHOT_DIR", "")
+	if schema.ViewDefinitions, err = getenvBool("SCHEMA_VIEW_DEFINITIONS", false); err != nil {
+		return nil, err
+	}
+	if schema.ProfileInterval, err = getenvDuration("SCHEMA_PROFILE_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if schema.ProfileMaxValues, err = getenvInt("SCHEMA_PROFILE_MAX_VALUES", 20); err != nil {
+		return nil, err
+	}
+	if schema.ProfileSampleRows, err = getenvInt("SCHEMA_PROFILE_SAMPLE_ROWS", 10_000); err != nil {
+		return nil, err
+	}
+	schema.ProfileExclude = append(getenvList("SCHEMA_PROFILE_EXCLUDE", nil), profileExclusions(exec)...)
+	schema.ProfileExcludeSemantic = exec.Masking.semanticTypes()
+
+	return &Config{DB: db, Neo4j: neo4j, Exec: exec, Ask: ask, Policy: policy, Schema: schema}, nil
 }
 
 func (d DatabaseConfig) ConnString() string {
+	if d.Dialect == dialect.SQLite {
+		// a conexão é aberta somente leitura; query_only barra escritas mesmo
+		// que o arquivo tenha permissão de escrita
+		return "file:" + d.Path + "?mode=ro&_pragma=query_only(1)&_pragma=busy_timeout(5000)"
+	}
+
+	if d.Dialect == dialect.MySQL {
+		return fmt.Sprintf(
+			"%s:%s@tcp(%s:%s)/%s?parseTime=true&loc=UTC&tls=%s",
+			d.User, d.Password, d.Host, d.Port, d.Name, mysqlTLS(d.SSLMode),
+		)
+	}
+
 	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		d.Host, d.Port, d.User, d.Password, d.Name, d.SSLMode,
 	)
 }
 
+// ReplicaConfig devolve a configuração de conexão de uma réplica, que só
+// muda o endereço em relação ao primário.
+func (d DatabaseConfig) ReplicaConfig(addr string) DatabaseConfig {
+	replica := d
+	replica.Replicas = nil
+	replica.Host = addr
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		replica.Host, replica.Port = host, port
+	}
+	return replica
+}
+
+// mysqlTLS traduz o DB_SSLMODE no estilo do Postgres para o parâmetro tls
+// do driver do MySQL.
+func mysqlTLS(sslMode string) string {
+	switch sslMode {
+	case "", "disable":
+		return "false"
+	case "verify-ca", "verify-full":
+		return "true"
+	default:
+		return "skip-verify"
+	}
+}
+
 func getenv(key string, defaultVal string) string {
 	val := os.Getenv(key)
 	if val == "" {
@@ -58,3 +362,195 @@ func getenv(key string, defaultVal string) string {
 	}
 	return val
 }
+
+func getenvBool(key string, defaultVal bool) (bool, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("valor inválido para %s: %w", key, err)
+	}
+	return b, nil
+}
+
+func getenvList(key string, defaultVal []string) []string {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+
+	var list []string
+	for _, item := range strings.Split(val, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getenvDuration(key string, defaultVal time.Duration) (time.Duration, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("valor inválido para %s: %w", key, err)
+	}
+	return d, nil
+}
+
+func getenvInt(key string, defaultVal int) (int, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("valor inválido para %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func getenvFloat(key string, defaultVal float64) (float64, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, fmt.Errorf("valor inválido para %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// profileExclusions devolve as colunas mascaradas em alguma política e as
+// tabelas com escopo de tenant, cujos valores não podem ir para o prompt de
+// qualquer chamador.
+func profileExclusions(exec ExecConfig) []string {
+	var keys []string
+	for table := range exec.TenantScopes {
+		keys = append(keys, table)
+	}
+	policies := []MaskingPolicy{exec.Masking.Default}
+	for _, p := range exec.Masking.Roles {
+		policies = append(policies, p)
+	}
+	for _, p := range policies {
+		for key := range p.Columns {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// parseTenantScopes lê entradas no formato "tabela=coluna" ou
+// "tabela=coluna:atributo", separadas por vírgula.
+func parseTenantScopes(val string) (map[string]TenantScope, error) {
+	scopes := map[string]TenantScope{}
+	for _, entry := range strings.Split(val, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		table, target, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(table) == "" || strings.TrimSpace(target) == "" {
+			return nil, fmt.Errorf("escopo de tenant inválido: %q", entry)
+		}
+
+		column, attribute, _ := strings.Cut(target, ":")
+		column = strings.TrimSpace(column)
+		attribute = strings.TrimSpace(attribute)
+		if attribute == "" {
+			attribute = column
+		}
+
+		scopes[strings.ToLower(strings.TrimSpace(table))] = TenantScope{Column: column, Attribute: attribute}
+	}
+	return scopes, nil
+}
+
+func loadMasking(path string) (MaskingConfig, error) {
+	var cfg MaskingConfig
+	if err := loadJSONFile(path, &cfg); err != nil {
+		return cfg, fmt.Errorf("erro ao carregar política de mascaramento: %w", err)
+	}
+
+	policies := map[string]MaskingPolicy{"default": cfg.Default}
+	for role, p := range cfg.Roles {
+		policies[role] = p
+	}
+	for role, p := range policies {
+		for key, strategy := range p.Columns {
+			if !maskingStrategies[strategy] {
+				return cfg, fmt.Errorf("estratégia de mascaramento inválida para %s em %s: %q", key, role, strategy)
+			}
+		}
+		for key, strategy := range p.SemanticTypes {
+			if !maskingStrategies[strategy] {
+				return cfg, fmt.Errorf("estratégia de mascaramento inválida para %s em %s: %q", key, role, strategy)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// semanticTypes devolve os tipos semânticos mascarados em alguma política.
+func (c MaskingConfig) semanticTypes() []string {
+	policies := []MaskingPolicy{c.Default}
+	for _, p := range c.Roles {
+		policies = append(policies, p)
+	}
+	var types []string
+	for _, p := range policies {
+		for semantic := range p.SemanticTypes {
+			if !slices.Contains(types, semantic) {
+				types = append(types, semantic)
+			}
+		}
+	}
+	return types
+}
+
+func (c MaskingConfig) usesStrategy(strategy string) bool {
+	policies := []MaskingPolicy{c.Default}
+	for _, p := range c.Roles {
+		policies = append(policies, p)
+	}
+	for _, p := range policies {
+		for _, s := range p.Columns {
+			if s == strategy {
+				return true
+			}
+		}
+		for _, s := range p.SemanticTypes {
+			if s == strategy {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func loadJSONFile(path string, v any) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDefaultDeniedFunctionsCoverTextReaders(t *testing.T) {
+	// funções que leem uma tabela ou consulta passada como texto escapam do
+	// escopo de tenant e da política de schema
+	for _, fn := range []string{"table_to_xml", "query_to_xml", "cursor_to_xml", "schema_to_xml", "database_to_xml", "query_to_xml_and_xmlschema", "table_to_xmlschema", "ts_stat"} {
+		if !slices.Contains(defaultDeniedFunctions, fn) {
+			t.Errorf("%s fora da lista padrão de funções proibidas", fn)
+		}
+	}
+}
+
+func TestLoadRequiresHashSalt(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		salt    string
+		wantErr bool
+	}{
+		{"hash sem salt", `{"default": {"columns": {"users.email": "hash"}}}`, "", true},
+		{"hash por tipo semântico sem salt", `{"roles": {"analyst": {"semantic_types": {"cpf": "hash"}}}}`, "", true},
+		{"hash com salt", `{"default": {"columns": {"users.email": "hash"}}}`, "segredo", false},
+		{"sem hash", `{"default": {"semantic_types": {"email": "redact"}}}`, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "masking.json")
+			if err := os.WriteFile(path, []byte(tt.policy), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("MASKING_POLICY_FILE", path)
+			t.Setenv("MASKING_HASH_SALT", tt.salt)
+
+			_, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsDisabledQueryStore(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		val  string
+	}{
+		{"sem consultas guardadas", "ASK_MAX_SAVED_QUERIES", "0"},
+		{"limite negativo", "ASK_MAX_SAVED_QUERIES", "-1"},
+		{"ttl zero", "ASK_QUERY_TTL", "0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.env, tt.val)
+			if _, err := Load(); err == nil {
+				t.Fatalf("%s=%s deveria ser recusado", tt.env, tt.val)
+			}
+		})
+	}
+}
+
+func TestProfileExclusionsFollowMasking(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "masking.json")
+	policy := `{"default": {"columns": {"users.salary": "drop"}}, "roles": {"support": {"semantic_types": {"email": "partial"}}}}`
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MASKING_POLICY_FILE", path)
+	t.Setenv("EXEC_TENANT_SCOPES", "orders=tenant_id")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"users.salary", "orders"} {
+		if !slices.Contains(cfg.Schema.ProfileExclude, key) {
+			t.Errorf("ProfileExclude = %v, falta %s", cfg.Schema.ProfileExclude, key)
+		}
+	}
+	if !slices.Equal(cfg.Schema.ProfileExcludeSemantic, []string{"email"}) {
+		t.Errorf("ProfileExcludeSemantic = %v", cfg.Schema.ProfileExcludeSemantic)
+	}
+}
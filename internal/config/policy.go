@@ -0,0 +1,92 @@
+package config
+
+import (
+	"slices"
+	"strings"
+)
+
+// SchemaPolicy define quais tabelas e colunas ficam visíveis para o prompt e
+// para as consultas geradas. Nomes podem vir com ou sem schema
+// ("farms" ou "public.farms"); colunas usam "tabela.coluna" ou "*.coluna".
+// Listas de permissão vazias liberam tudo que não estiver negado.
+type SchemaPolicy struct {
+	AllowTables  []string            `json:"allow_tables"`
+	DenyTables   []string            `json:"deny_tables"`
+	AllowColumns map[string][]string `json:"allow_columns"`
+	DenyColumns  []string            `json:"deny_columns"`
+}
+
+func (p SchemaPolicy) TableVisible(schema, table string) bool {
+	names := tableKeys(schema, table)
+
+	if containsAnyFold(p.DenyTables, names) {
+		return false
+	}
+	if len(p.AllowTables) > 0 && !containsAnyFold(p.AllowTables, names) {
+		return false
+	}
+	return true
+}
+
+func (p SchemaPolicy) ColumnVisible(schema, table, column string) bool {
+	if !p.TableVisible(schema, table) {
+		return false
+	}
+
+	column = strings.ToLower(column)
+	keys := []string{"*." + column}
+	for _, name := range tableKeys(schema, table) {
+		keys = append(keys, name+"."+column)
+	}
+	if containsAnyFold(p.DenyColumns, keys) {
+		return false
+	}
+
+	for _, name := range tableKeys(schema, table) {
+		for key, allowed := range p.AllowColumns {
+			if strings.EqualFold(key, name) {
+				return containsAnyFold(allowed, []string{column})
+			}
+		}
+	}
+	return true
+}
+
+// HasColumnRestrictions indica se alguma coluna da tabela pode estar oculta,
+// caso em que SELECT * e referências à linha inteira não são seguros.
+func (p SchemaPolicy) HasColumnRestrictions(schema, table string) bool {
+	names := tableKeys(schema, table)
+	for key := range p.AllowColumns {
+		if containsAnyFold(names, []string{key}) {
+			return true
+		}
+	}
+	for _, key := range p.DenyColumns {
+		prefix := key[:max(strings.LastIndex(key, "."), 0)]
+		if prefix == "*" || containsAnyFold(names, []string{prefix}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Restricted indica se a política esconde alguma tabela ou coluna.
+func (p SchemaPolicy) Restricted() bool {
+	return len(p.AllowTables) > 0 || len(p.DenyTables) > 0 || len(p.AllowColumns) > 0 || len(p.DenyColumns) > 0
+}
+
+func tableKeys(schema, table string) []string {
+	table = strings.ToLower(table)
+	if schema == "" {
+		return []string{table}
+	}
+	return []string{table, strings.ToLower(schema) + "." + table}
+}
+
+func containsAnyFold(list []string, items []string) bool {
+	return slices.ContainsFunc(list, func(v string) bool {
+		return slices.ContainsFunc(items, func(item string) bool {
+			return strings.EqualFold(v, item)
+		})
+	})
+}
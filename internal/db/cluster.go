@@ -0,0 +1,292 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"rag-sql/internal/config"
+	"rag-sql/internal/db/dialect"
+	"sync/atomic"
+	"time"
+)
+
+// Querier é satisfeito tanto por *sql.DB quanto por *Cluster.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Cluster distribui as leituras entre as réplicas saudáveis em round-robin
+// e cai para o primário quando nenhuma está disponível. Uma réplica fica
+// fora do rodízio quando não responde ou está atrasada além do limite.
+type Cluster struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     atomic.Uint64
+	cfg      config.DatabaseConfig
+}
+
+type replica struct {
+	addr    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// NewCluster conecta ao primário e abre as réplicas. Réplicas fora do ar não
+// impedem a subida; elas entram no rodízio quando passarem na verificação.
+func NewCluster(cfg config.DatabaseConfig) *Cluster {
+	c := &Cluster{primary: Connect(cfg), cfg: cfg}
+
+	for _, addr := range cfg.Replicas {
+		conn, err := sql.Open(dialect.DriverName(cfg.Dialect), cfg.ReplicaConfig(addr).ConnString())
+		if err != nil {
+			log.Printf("erro ao abrir réplica %s: %v", addr, err)
+			continue
+		}
+		r := &replica{addr: addr, db: conn}
+		// começa no rodízio para que a primeira verificação registre no log
+		// as réplicas que já sobem fora do ar
+		r.healthy.Store(true)
+		c.replicas = append(c.replicas, r)
+	}
+
+	c.checkReplicas(context.Background())
+	return c
+}
+
+func (c *Cluster) Primary() *sql.DB {
+	return c.primary
+}
+
+// Introspection devolve a conexão usada para ler o schema: o primário
+// quando configurado assim, ou o próprio cluster.
+func (c *Cluster) Introspection() Querier {
+	if c.cfg.IntrospectPrimary {
+		return c.primary
+	}
+	return c
+}
+
+// Watch verifica as réplicas a cada intervalo até o contexto ser cancelado.
+func (c *Cluster) Watch(ctx context.Context) {
+	if len(c.replicas) == 0 || c.cfg.ReplicaCheckInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.cfg.ReplicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkReplicas(ctx)
+		}
+	}
+}
+
+func (c *Cluster) checkReplicas(ctx context.Context) {
+	for _, r := range c.replicas {
+		err := c.checkReplica(ctx, r)
+		healthy := err == nil
+		if r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				log.Printf("réplica %s de volta ao rodízio", r.addr)
+			} else {
+				log.Printf("réplica %s fora do rodízio: %v", r.addr, err)
+			}
+		}
+	}
+}
+
+func (c *Cluster) checkReplica(ctx context.Context, r *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := r.db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	lag, err := replicationLag(ctx, c.cfg.Dialect, r.db)
+	return checkLag(lag, err, c.cfg.ReplicaMaxLag)
+}
+
+// checkLag decide se a réplica fica no rodízio pelo atraso medido. Sem
+// limite de atraso basta a réplica responder; com limite, atraso
+// desconhecido a tira do rodízio.
+func checkLag(lag time.Duration, err error, limit time.Duration) error {
+	if errors.Is(err, errLagUnknown) && limit <= 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if limit > 0 && lag > limit {
+		return &lagError{lag: lag, max: limit}
+	}
+	return nil
+}
+
+type lagError struct {
+	lag, max time.Duration
+}
+
+func (e *lagError) Error() string {
+	return "atraso de replicação de " + e.lag.Round(time.Second).String() + " acima do limite de " + e.max.String()
+}
+
+// errLagUnknown indica que o atraso da réplica não pode ser medido; com
+// DB_REPLICA_MAX_LAG ligado a réplica fica fora do rodízio.
+var errLagUnknown = errors.New("atraso de replicação desconhecido")
+
+// replicationLag mede o atraso da réplica. No Postgres vem de postgresLag;
+// no MySQL, do SHOW REPLICA STATUS; no SQLite não há como medir.
+func replicationLag(ctx context.Context, dialectName string, conn *sql.DB) (time.Duration, error) {
+	switch dialectName {
+	case dialect.MySQL:
+		return mysqlReplicationLag(ctx, conn)
+	case dialect.SQLite:
+		return 0, errLagUnknown
+	}
+
+	// sem pg_read_all_stats o pg_stat_wal_receiver só mostra o pid; um
+	// receptor de pé conta como transmitindo
+	var st pgReplicaStatus
+	err := conn.QueryRowContext(ctx, `
+		SELECT pg_is_in_recovery(),
+			EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming'),
+			COALESCE(pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn(), false),
+			EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+	`).Scan(&st.inRecovery, &st.streaming, &st.caughtUp, &st.replayAge)
+	if err != nil {
+		return 0, err
+	}
+	return postgresLag(st)
+}
+
+type pgReplicaStatus struct {
+	inRecovery bool
+	// streaming indica que o receptor de WAL está conectado ao primário
+	streaming bool
+	// caughtUp indica que todo o WAL recebido já foi aplicado
+	caughtUp bool
+	// replayAge é o tempo desde a última transação aplicada
+	replayAge sql.NullFloat64
+}
+
+// postgresLag só considera sem atraso a réplica que recebe WAL do primário e
+// já aplicou tudo, mesmo que o primário esteja parado há tempo. Com o
+// receptor desconectado o que foi recebido pode estar longe do primário, e
+// vale o tempo desde a última transação aplicada.
+func postgresLag(st pgReplicaStatus) (time.Duration, error) {
+	switch {
+	case !st.inRecovery:
+		return 0, nil
+	case st.streaming && st.caughtUp:
+		return 0, nil
+	case !st.replayAge.Valid:
+		return 0, fmt.Errorf("%w: nenhuma transação aplicada", errLagUnknown)
+	}
+	return time.Duration(st.replayAge.Float64 * float64(time.Second)), nil
+}
+
+// mysqlReplicationLag lê Seconds_Behind_Source, que fica NULL quando a
+// replicação está parada. Um servidor sem status de réplica não é réplica e
+// não tem atraso. Versões anteriores à 8.0.22 só conhecem SHOW SLAVE STATUS.
+func mysqlReplicationLag(ctx context.Context, conn *sql.DB) (time.Duration, error) {
+	rows, err := conn.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		if rows, err = conn.QueryContext(ctx, "SHOW SLAVE STATUS"); err != nil {
+			return 0, err
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return 0, err
+	}
+
+	for i, name := range columns {
+		if name != "Seconds_Behind_Source" && name != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, fmt.Errorf("%w: replicação parada", errLagUnknown)
+		}
+		var seconds int64
+		if _, err := fmt.Sscan(values[i].String, &seconds); err != nil {
+			return 0, fmt.Errorf("Seconds_Behind_Source inválido: %q", values[i].String)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errLagUnknown
+}
+
+// reader escolhe a próxima réplica saudável; nil significa usar o primário.
+func (c *Cluster) reader() *replica {
+	n := len(c.replicas)
+	start := c.next.Add(1)
+	for i := 0; i < n; i++ {
+		r := c.replicas[(start+uint64(i))%uint64(n)]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// fallback tira a réplica do rodízio depois de uma falha que não veio do
+// contexto da requisição; a próxima verificação decide se ela volta.
+func (c *Cluster) fallback(ctx context.Context, r *replica, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if r.healthy.Swap(false) {
+		log.Printf("réplica %s fora do rodízio, usando o primário: %v", r.addr, err)
+	}
+	return true
+}
+
+func (c *Cluster) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if r := c.reader(); r != nil {
+		tx, err := r.db.BeginTx(ctx, opts)
+		if err == nil || !c.fallback(ctx, r, err) {
+			return tx, err
+		}
+	}
+	return c.primary.BeginTx(ctx, opts)
+}
+
+func (c *Cluster) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if r := c.reader(); r != nil {
+		rows, err := r.db.QueryContext(ctx, query, args...)
+		if err == nil || !c.fallback(ctx, r, err) {
+			return rows, err
+		}
+	}
+	return c.primary.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext não tem como cair para o primário, já que o erro só
+// aparece no Scan.
+func (c *Cluster) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if r := c.reader(); r != nil {
+		return r.db.QueryRowContext(ctx, query, args...)
+	}
+	return c.primary.QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPostgresLag(t *testing.T) {
+	age := func(seconds float64) sql.NullFloat64 { return sql.NullFloat64{Float64: seconds, Valid: true} }
+
+	tests := []struct {
+		name    string
+		st      pgReplicaStatus
+		want    time.Duration
+		unknown bool
+	}{
+		{"primário", pgReplicaStatus{replayAge: age(3600)}, 0, false},
+		// o primário parado não é atraso
+		{"transmitindo e em dia", pgReplicaStatus{inRecovery: true, streaming: true, caughtUp: true, replayAge: age(3600)}, 0, false},
+		{"transmitindo com WAL por aplicar", pgReplicaStatus{inRecovery: true, streaming: true, replayAge: age(90)}, 90 * time.Second, false},
+		// aplicou tudo que recebeu, mas não recebe mais nada
+		{"receptor desconectado", pgReplicaStatus{inRecovery: true, caughtUp: true, replayAge: age(600)}, 600 * time.Second, false},
+		{"desconectado sem transação aplicada", pgReplicaStatus{inRecovery: true, caughtUp: true}, 0, true},
+		{"transmitindo sem transação aplicada", pgReplicaStatus{inRecovery: true, streaming: true}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lag, err := postgresLag(tt.st)
+			if tt.unknown {
+				if !errors.Is(err, errLagUnknown) {
+					t.Fatalf("err = %v, want errLagUnknown", err)
+				}
+				return
+			}
+			if err != nil || lag != tt.want {
+				t.Fatalf("postgresLag = %v, %v; want %v", lag, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLag(t *testing.T) {
+	failed := errors.New("conexão recusada")
+
+	tests := []struct {
+		name    string
+		lag     time.Duration
+		err     error
+		limit   time.Duration
+		healthy bool
+	}{
+		{"sem limite", time.Hour, nil, 0, true},
+		{"dentro do limite", 5 * time.Second, nil, 10 * time.Second, true},
+		{"acima do limite", 11 * time.Second, nil, 10 * time.Second, false},
+		{"desconhecido sem limite", 0, errLagUnknown, 0, true},
+		{"desconhecido com limite", 0, errLagUnknown, 10 * time.Second, false},
+		{"erro na medição", 0, failed, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLag(tt.lag, tt.err, tt.limit)
+			if (err == nil) != tt.healthy {
+				t.Fatalf("checkLag = %v, want saudável = %v", err, tt.healthy)
+			}
+		})
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"database/sql"
 	"log"
 	"rag-sql/internal/config"
+	"rag-sql/internal/db/dialect"
 
+	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 func Connect(cfg config.DatabaseConfig) *sql.DB {
-	db, err := sql.Open("postgres", cfg.ConnString())
+	db, err := sql.Open(dialect.DriverName(cfg.Dialect), cfg.ConnString())
 	if err != nil {
 		log.Fatalf("erro ao abrir conexão com banco: %v", err)
 	}
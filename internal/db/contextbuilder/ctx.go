@@ -3,27 +3,64 @@ package contextbuilder
 import (
 	"context"
 	"fmt"
+	"rag-sql/internal/db/dbschema"
+	"rag-sql/internal/db/dialect"
+	"rag-sql/internal/db/schemautil"
 	"rag-sql/internal/graph"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Builder struct {
-	graph *graph.Neo4jGraph
+	graph    *graph.Neo4jGraph
+	dialect  string
+	profiles ValueProfiles
 }
 
-func New(g *graph.Neo4jGraph) *Builder {
-	return &Builder{graph: g}
+// ValueProfiles fornece os valores reais e as estatísticas das colunas de
+// uma tabela, pelo nome qualificado.
+type ValueProfiles interface {
+	ColumnProfiles(table string) []dbschema.ColumnProfile
+	TableStats(table string) (dbschema.TableStats, bool)
 }
 
-func (b *Builder) BuildPrompt(schema string, question string, logic []string, lastError string) string {
+// mostlyNull é a fração de nulos a partir da qual o prompt avisa que a
+// coluna quase nunca tem valor.
+const mostlyNull = 0.5
+
+// New aceita profiles nil, caso em que o prompt vai sem exemplos de valores.
+func New(g *graph.Neo4jGraph, dialectName string, profiles ValueProfiles) *Builder {
+	return &Builder{graph: g, dialect: dialectName, profiles: profiles}
+}
+
+// BuildPrompt monta o prompt e devolve também as tabelas incluídas nele.
+func (b *Builder) BuildPrompt(ctx context.Context, schema *dbschema.Schema, question string, logic []string, lastError string) (string, []string) {
 	var sb strings.Builder
 
-	tablesToInclude := b.selectRelevantTables(schema, question)
+	tablesToInclude, selected := b.selectRelevantTables(ctx, schema, question)
+
+	sb.WriteString("## DIALETO SQL:\n")
+	for _, hint := range dialect.PromptHints(b.dialect) {
+		sb.WriteString("- " + hint + "\n")
+	}
+	sb.WriteString("\n")
 
 	sb.WriteString("## ESQUEMA DO BANCO DE DADOS:\n")
+	sb.WriteString("Os comentários (-- ...) descrevem o significado das tabelas e colunas.\n")
 	sb.WriteString(tablesToInclude)
 	sb.WriteString("\n\n")
 
+	if values := b.valueExamples(selected); len(values) > 0 {
+		sb.WriteString("## VALORES DAS COLUNAS:\n")
+		sb.WriteString("Estimativas e valores tirados das estatísticas do banco ou de uma amostra; use os valores exatamente como aparecem nos filtros.\n")
+		for _, line := range values {
+			sb.WriteString("- " + line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
 	if len(logic) > 0 {
 		sb.WriteString("## LÓGICA DE NEGÓCIO:\n")
 		for _, rule := range logic {
@@ -42,46 +79,193 @@ func (b *Builder) BuildPrompt(schema string, question string, logic []string, la
 	sb.WriteString(question)
 	sb.WriteString("\nSQL:")
 
-	return sb.String()
+	return sb.String(), selected
 }
 
-func (b *Builder) selectRelevantTables(schema, question string) string {
-	tables := strings.Split(schema, "\n\n")
-	var baseTables []string
+// selectRelevantTables escolhe as tabelas ligadas à pergunta e as descreve
+// como DDL, junto com os tipos enum que elas usam. Sem nenhuma escolhida vai
+// o schema inteiro.
+func (b *Builder) selectRelevantTables(ctx context.Context, schema *dbschema.Schema, question string) (string, []string) {
+	var baseTables, known []string
 	qLower := strings.ToLower(question)
+	// scores ordena as tabelas do prompt: nome citado, valor de coluna
+	// citado, alias no grafo e, por último, coluna ou comentário
+	scores := map[string]int{}
 
-	for _, table := range tables {
-		tableLower := strings.ToLower(table)
-		if strings.Contains(tableLower, "create table") {
-			tableName := extractTableName(tableLower)
-			if strings.Contains(qLower, tableName) || containsAnyColumn(qLower, tableLower) {
-				baseTables = append(baseTables, tableName)
-			}
+	for _, t := range schema.Tables {
+		tableName := strings.ToLower(t.QualifiedName())
+		known = append(known, tableName)
+		// a pergunta cita a tabela pelo nome, raramente com o schema
+		switch {
+		case strings.Contains(qLower, strings.ToLower(t.Name)):
+			scores[tableName] = 4
+		case b.matchesValue(qLower, tableName):
+			scores[tableName] = 3
+		case containsAnyColumn(qLower, t) || matchesComment(qLower, t):
+			scores[tableName] = 1
+		default:
+			continue
 		}
+		baseTables = append(baseTables, tableName)
 	}
 
-	graphTables := b.findTablesByGraph(qLower)
+	graphTables := qualifyTables(b.findTablesByGraph(ctx, qLower), known)
+	for _, t := range graphTables {
+		scores[t] = max(scores[t], 2)
+	}
 	baseTables = append(baseTables, graphTables...)
 	baseTables = uniqueStrings(baseTables)
 
-	ctx := context.Background()
 	expandedTables, err := b.expandTablesFromGraph(ctx, baseTables, 1)
 	if err != nil {
 		expandedTables = baseTables
 	}
 
-	var relevantDefs []string
-	for _, table := range tables {
-		tableName := extractTableName(strings.ToLower(table))
+	var relevant []dbschema.Table
+	var selected, all []string
+	for _, t := range schema.Tables {
+		tableName := strings.ToLower(t.QualifiedName())
+		all = append(all, tableName)
 		if contains(expandedTables, tableName) {
-			relevantDefs = append(relevantDefs, table)
+			relevant = append(relevant, t)
+			selected = append(selected, tableName)
+		}
+	}
+
+	if len(relevant) == 0 {
+		return dbschema.RenderDDL(schema), all
+	}
+	b.rankTables(relevant, selected, scores)
+
+	return dbschema.RenderDDL(&dbschema.Schema{Enums: usedEnums(schema.Enums, relevant), Tables: relevant}), selected
+}
+
+// usedEnums devolve os tipos enum usados nas colunas das tabelas. Nas
+// colunas o tipo aparece sem o schema quando está no search_path.
+func usedEnums(enums []dbschema.Enum, tables []dbschema.Table) []dbschema.Enum {
+	types := map[string]bool{}
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			typ := strings.TrimSuffix(strings.ReplaceAll(strings.ToLower(c.Type), `"`, ""), "[]")
+			types[typ] = true
+		}
+	}
+
+	var used []dbschema.Enum
+	for _, e := range enums {
+		if types[strings.ToLower(e.Name)] || types[strings.ToLower(e.QualifiedName())] {
+			used = append(used, e)
+		}
+	}
+	return used
+}
+
+// rankTables ordena as tabelas selecionadas e os nomes delas pela
+// pontuação e, no empate, pelo número estimado de linhas, já que as tabelas
+// grandes costumam ser as de fatos.
+func (b *Builder) rankTables(tables []dbschema.Table, names []string, scores map[string]int) {
+	rows := make(map[string]float64, len(names))
+	if b.profiles != nil {
+		for _, name := range names {
+			if stats, ok := b.profiles.TableStats(name); ok {
+				rows[name] = stats.EstimatedRows
+			}
+		}
+	}
+
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		x, y := names[order[i]], names[order[j]]
+		if scores[x] != scores[y] {
+			return scores[x] > scores[y]
+		}
+		return rows[x] > rows[y]
+	})
+
+	sortedTables := make([]dbschema.Table, len(order))
+	sortedNames := make([]string, len(order))
+	for i, k := range order {
+		sortedTables[i], sortedNames[i] = tables[k], names[k]
+	}
+	copy(tables, sortedTables)
+	copy(names, sortedNames)
+}
+
+// matchesValue indica se a pergunta cita algum valor conhecido das colunas
+// da tabela, como "cancelado" numa coluna status.
+func (b *Builder) matchesValue(q, table string) bool {
+	if b.profiles == nil {
+		return false
+	}
+
+	qWords := map[string]bool{}
+	for _, w := range commentWords(q) {
+		qWords[w] = true
+	}
+	for _, p := range b.profiles.ColumnProfiles(table) {
+		for _, v := range p.Values {
+			for _, w := range commentWords(v) {
+				if qWords[w] {
+					return true
+				}
+			}
 		}
 	}
+	return false
+}
+
+// valueExamples descreve as tabelas do prompt: o número estimado de linhas,
+// os valores ou o intervalo das colunas e as colunas quase sempre nulas.
+func (b *Builder) valueExamples(tables []string) []string {
+	if b.profiles == nil {
+		return nil
+	}
 
-	if len(relevantDefs) == 0 {
-		return schema
+	var lines []string
+	for _, table := range tables {
+		nulls := map[string]float64{}
+		stats, ok := b.profiles.TableStats(table)
+		if ok && stats.EstimatedRows > 0 {
+			lines = append(lines, fmt.Sprintf("%s: cerca de %.0f linhas", table, stats.EstimatedRows))
+		}
+		for _, c := range stats.Columns {
+			if c.NullFraction >= mostlyNull {
+				nulls[c.Column] = c.NullFraction
+			}
+		}
+
+		for _, p := range b.profiles.ColumnProfiles(table) {
+			name := table + "." + p.Column
+			var line string
+			switch {
+			case len(p.Values) > 0:
+				values := make([]string, len(p.Values))
+				for i, v := range p.Values {
+					values[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+				}
+				line = name + ": " + strings.Join(values, ", ")
+			case p.Min != "":
+				line = fmt.Sprintf("%s: de %s a %s", name, p.Min, p.Max)
+			default:
+				continue
+			}
+			if frac, ok := nulls[p.Column]; ok {
+				line += fmt.Sprintf(" (%.0f%% nulos)", frac*100)
+				delete(nulls, p.Column)
+			}
+			lines = append(lines, line)
+		}
+
+		for _, c := range stats.Columns {
+			if frac, ok := nulls[c.Column]; ok {
+				lines = append(lines, fmt.Sprintf("%s.%s: %.0f%% nulos", table, c.Column, frac*100))
+			}
+		}
 	}
-	return strings.Join(relevantDefs, "\n\n")
+	return lines
 }
 
 func (b *Builder) expandTablesFromGraph(ctx context.Context, baseTables []string, depth int) ([]string, error) {
@@ -104,35 +288,81 @@ func (b *Builder) expandTablesFromGraph(ctx context.Context, baseTables []string
 	return expanded, nil
 }
 
-func extractTableName(tableDef string) string {
-	start := strings.Index(tableDef, "create table") + len("create table")
-	end := strings.Index(tableDef[start:], "(")
-	if start < 0 || end < 0 {
-		return ""
+// qualifyTables troca nomes sem schema, como os dos aliases antigos do grafo,
+// pelos nomes qualificados das tabelas do schema com o mesmo nome.
+func qualifyTables(names, known []string) []string {
+	var qualified []string
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if contains(known, name) {
+			qualified = append(qualified, name)
+			continue
+		}
+		for _, k := range known {
+			if _, bare := schemautil.SplitQualified(k); bare == name {
+				qualified = append(qualified, k)
+			}
+		}
 	}
-	return strings.TrimSpace(tableDef[start : start+end])
+	return qualified
 }
 
-func containsAnyColumn(q string, tableDef string) bool {
-	colsStart := strings.Index(tableDef, "(")
-	colsEnd := strings.LastIndex(tableDef, ")")
-	if colsStart == -1 || colsEnd == -1 || colsEnd <= colsStart {
-		return false
-	}
-	cols := tableDef[colsStart+1 : colsEnd]
-	lines := strings.Split(cols, "\n")
-	for _, line := range lines {
-		col := strings.TrimSpace(strings.Split(line, " ")[0])
-		if col != "" && strings.Contains(q, col) {
+func containsAnyColumn(q string, t dbschema.Table) bool {
+	for _, c := range t.Columns {
+		if col := strings.ToLower(c.Name); col != "" && strings.Contains(q, col) {
 			return true
 		}
 	}
 	return false
 }
 
-func (b *Builder) findTablesByGraph(question string) []string {
-	ctx := context.Background()
+// matchesComment indica se a pergunta usa alguma palavra dos comentários
+// da tabela ou das colunas.
+func matchesComment(q string, t dbschema.Table) bool {
+	qWords := map[string]bool{}
+	for _, w := range commentWords(q) {
+		qWords[w] = true
+	}
+	comments := []string{t.Comment}
+	for _, c := range t.Columns {
+		comments = append(comments, c.Comment)
+	}
+	for _, comment := range comments {
+		for _, w := range commentWords(comment) {
+			if qWords[w] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commentWords separa as palavras com quatro letras ou mais, sem o plural
+// em "s" e sem as palavras comuns demais para indicar uma tabela.
+func commentWords(text string) []string {
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		w = strings.TrimSuffix(w, "s")
+		if utf8.RuneCountInString(w) < 4 || stopWords[w] {
+			continue
+		}
+		words = append(words, w)
+	}
+	return words
+}
+
+var stopWords = map[string]bool{
+	"qual": true, "quai": true, "quanto": true, "quanta": true, "para": true, "como": true,
+	"onde": true, "quando": true, "entre": true, "sobre": true, "cada": true, "mai": true,
+	"meno": true, "pelo": true, "pela": true, "todo": true, "toda": true, "esta": true,
+	"este": true, "essa": true, "esse": true, "isso": true,
+	"possui": true, "registro": true, "tabela": true, "coluna": true, "valor": true,
+	"with": true, "from": true, "that": true, "this": true, "which": true,
+}
 
+func (b *Builder) findTablesByGraph(ctx context.Context, question string) []string {
 	tables, err := b.graph.FindEntitiesByAlias(ctx, question)
 	if err != nil {
 		fmt.Printf("Erro ao buscar aliases no grafo: %v\n", err)
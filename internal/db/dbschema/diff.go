@@ -0,0 +1,259 @@
+package dbschema
+
+import (
+	"slices"
+	"sort"
+)
+
+// SchemaDiff lista o que mudou entre dois modelos do schema. From e To são
+// os IDs dos snapshots comparados, quando vêm do histórico.
+type SchemaDiff struct {
+	From          string      `json:"from,omitempty"`
+	To            string      `json:"to,omitempty"`
+	AddedTables   []string    `json:"added_tables,omitempty"`
+	RemovedTables []string    `json:"removed_tables,omitempty"`
+	RenamedTables []Rename    `json:"renamed_tables,omitempty"`
+	ChangedTables []TableDiff `json:"changed_tables,omitempty"`
+}
+
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// TableDiff são as mudanças de uma tabela que existe nos dois modelos, com
+// o nome novo quando ela foi renomeada. As FKs aparecem como no DDL.
+type TableDiff struct {
+	Table              string       `json:"table"`
+	AddedColumns       []string     `json:"added_columns,omitempty"`
+	RemovedColumns     []string     `json:"removed_columns,omitempty"`
+	RenamedColumns     []Rename     `json:"renamed_columns,omitempty"`
+	TypeChanges        []TypeChange `json:"type_changes,omitempty"`
+	AddedForeignKeys   []string     `json:"added_foreign_keys,omitempty"`
+	RemovedForeignKeys []string     `json:"removed_foreign_keys,omitempty"`
+}
+
+type TypeChange struct {
+	Column string `json:"column"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// renameSimilarity é a fração mínima de colunas iguais (nome e tipo) para
+// uma tabela removida e uma criada serem tratadas como renomeação.
+const renameSimilarity = 0.8
+
+// Empty indica se não há diferença em tabelas, colunas ou FKs.
+func (d SchemaDiff) Empty() bool {
+	return len(d.AddedTables) == 0 && len(d.RemovedTables) == 0 && len(d.RenamedTables) == 0 && len(d.ChangedTables) == 0
+}
+
+// Diff compara dois modelos. Renomeações são inferidas: o catálogo não
+// guarda nomes antigos, então uma tabela removida e uma criada com quase as
+// mesmas colunas, ou uma coluna removida e uma criada com o mesmo tipo sem
+// outra candidata, contam como renomeadas.
+func Diff(from, to *Schema) SchemaDiff {
+	before := tablesByName(from)
+	after := tablesByName(to)
+
+	var d SchemaDiff
+	var removed, added []Table
+	for _, t := range from.Tables {
+		if _, ok := after[t.QualifiedName()]; !ok {
+			removed = append(removed, t)
+		}
+	}
+	for _, t := range to.Tables {
+		old, ok := before[t.QualifiedName()]
+		if !ok {
+			added = append(added, t)
+			continue
+		}
+		if td := diffTable(old, t); !td.empty() {
+			d.ChangedTables = append(d.ChangedTables, td)
+		}
+	}
+
+	renamed := matchRenamedTables(removed, added)
+	for _, r := range renamed {
+		d.RenamedTables = append(d.RenamedTables, Rename{From: r[0].QualifiedName(), To: r[1].QualifiedName()})
+		if td := diffTable(r[0], r[1]); !td.empty() {
+			d.ChangedTables = append(d.ChangedTables, td)
+		}
+	}
+	for _, t := range removed {
+		if !slices.ContainsFunc(renamed, func(r [2]Table) bool { return r[0].QualifiedName() == t.QualifiedName() }) {
+			d.RemovedTables = append(d.RemovedTables, t.QualifiedName())
+		}
+	}
+	for _, t := range added {
+		if !slices.ContainsFunc(renamed, func(r [2]Table) bool { return r[1].QualifiedName() == t.QualifiedName() }) {
+			d.AddedTables = append(d.AddedTables, t.QualifiedName())
+		}
+	}
+
+	sort.Slice(d.ChangedTables, func(i, j int) bool { return d.ChangedTables[i].Table < d.ChangedTables[j].Table })
+	return d
+}
+
+// GoneTables devolve as tabelas que deixaram de existir com o nome antigo:
+// as removidas e as renomeadas.
+func (d SchemaDiff) GoneTables() []string {
+	gone := slices.Clone(d.RemovedTables)
+	for _, r := range d.RenamedTables {
+		gone = append(gone, r.From)
+	}
+	return gone
+}
+
+func tablesByName(schema *Schema) map[string]Table {
+	m := make(map[string]Table, len(schema.Tables))
+	for _, t := range schema.Tables {
+		m[t.QualifiedName()] = t
+	}
+	return m
+}
+
+// matchRenamedTables forma pares (removida, criada) do mesmo tipo de objeto,
+// começando pelos mais parecidos.
+func matchRenamedTables(removed, added []Table) [][2]Table {
+	type candidate struct {
+		from, to int
+		score    float64
+	}
+	var candidates []candidate
+	for i, r := range removed {
+		for j, a := range added {
+			if r.Kind != a.Kind {
+				continue
+			}
+			if score := columnSimilarity(r, a); score >= renameSimilarity {
+				candidates = append(candidates, candidate{i, j, score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	usedFrom := map[int]bool{}
+	usedTo := map[int]bool{}
+	var pairs [][2]Table
+	for _, c := range candidates {
+		if usedFrom[c.from] || usedTo[c.to] {
+			continue
+		}
+		usedFrom[c.from], usedTo[c.to] = true, true
+		pairs = append(pairs, [2]Table{removed[c.from], added[c.to]})
+	}
+	return pairs
+}
+
+func columnSimilarity(a, b Table) float64 {
+	keys := map[string]int{}
+	for _, c := range a.Columns {
+		keys[c.Name+" "+c.Type] |= 1
+	}
+	for _, c := range b.Columns {
+		keys[c.Name+" "+c.Type] |= 2
+	}
+	if len(keys) == 0 {
+		return 0
+	}
+	common := 0
+	for _, v := range keys {
+		if v == 3 {
+			common++
+		}
+	}
+	return float64(common) / float64(len(keys))
+}
+
+func diffTable(from, to Table) TableDiff {
+	td := TableDiff{Table: to.QualifiedName()}
+
+	before := map[string]Column{}
+	for _, c := range from.Columns {
+		before[c.Name] = c
+	}
+	after := map[string]Column{}
+	for _, c := range to.Columns {
+		after[c.Name] = c
+	}
+
+	var removed, added []Column
+	for _, c := range from.Columns {
+		if _, ok := after[c.Name]; !ok {
+			removed = append(removed, c)
+		}
+	}
+	for _, c := range to.Columns {
+		old, ok := before[c.Name]
+		if !ok {
+			added = append(added, c)
+			continue
+		}
+		if old.Type != c.Type {
+			td.TypeChanges = append(td.TypeChanges, TypeChange{Column: c.Name, From: old.Type, To: c.Type})
+		}
+	}
+
+	// uma coluna removida e uma criada com o mesmo tipo e nulidade são a
+	// mesma coluna renomeada, desde que nenhuma das duas tenha outro par
+	sameShape := func(a, b Column) bool { return a.Type == b.Type && a.Nullable == b.Nullable }
+	renamedTo := map[string]bool{}
+	for _, r := range removed {
+		var match []Column
+		for _, a := range added {
+			if sameShape(r, a) {
+				match = append(match, a)
+			}
+		}
+		if len(match) == 1 && countFunc(removed, func(c Column) bool { return sameShape(c, match[0]) }) == 1 {
+			td.RenamedColumns = append(td.RenamedColumns, Rename{From: r.Name, To: match[0].Name})
+			renamedTo[match[0].Name] = true
+			continue
+		}
+		td.RemovedColumns = append(td.RemovedColumns, r.Name)
+	}
+	for _, a := range added {
+		if !renamedTo[a.Name] {
+			td.AddedColumns = append(td.AddedColumns, a.Name)
+		}
+	}
+
+	beforeFKs := fkDefinitions(from.ForeignKeys)
+	afterFKs := fkDefinitions(to.ForeignKeys)
+	for _, def := range afterFKs {
+		if !slices.Contains(beforeFKs, def) {
+			td.AddedForeignKeys = append(td.AddedForeignKeys, def)
+		}
+	}
+	for _, def := range beforeFKs {
+		if !slices.Contains(afterFKs, def) {
+			td.RemovedForeignKeys = append(td.RemovedForeignKeys, def)
+		}
+	}
+	return td
+}
+
+func (td TableDiff) empty() bool {
+	return len(td.AddedColumns) == 0 && len(td.RemovedColumns) == 0 && len(td.RenamedColumns) == 0 &&
+		len(td.TypeChanges) == 0 && len(td.AddedForeignKeys) == 0 && len(td.RemovedForeignKeys) == 0
+}
+
+func fkDefinitions(fks []ForeignKey) []string {
+	defs := make([]string, len(fks))
+	for i, fk := range fks {
+		defs[i] = fkDefinition(fk)
+	}
+	return defs
+}
+
+func countFunc[T any](list []T, fn func(T) bool) int {
+	n := 0
+	for _, v := range list {
+		if fn(v) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,84 @@
+package dbschema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	customerFK := ForeignKey{Columns: []string{"customer_id"}, RefSchema: "public", RefTable: "customers", RefColumns: []string{"id"}}
+	clientFK := ForeignKey{Columns: []string{"client_id"}, RefSchema: "public", RefTable: "clients", RefColumns: []string{"id"}}
+
+	from := &Schema{Tables: []Table{
+		{Schema: "public", Name: "orders", Kind: "table", Columns: []Column{
+			{Name: "id", Type: "integer"},
+			{Name: "customer_id", Type: "integer"},
+			{Name: "total", Type: "numeric(10,2)"},
+			{Name: "note", Type: "varchar(200)", Nullable: true},
+			{Name: "legacy", Type: "text", Nullable: true},
+			{Name: "legacy2", Type: "text", Nullable: true},
+		}, ForeignKeys: []ForeignKey{customerFK}},
+		{Schema: "public", Name: "customers", Kind: "table", Columns: []Column{
+			{Name: "id", Type: "integer"},
+			{Name: "name", Type: "text"},
+			{Name: "email", Type: "text"},
+			{Name: "phone", Type: "text"},
+			{Name: "city", Type: "text"},
+		}},
+		{Schema: "public", Name: "logs", Kind: "table", Columns: []Column{{Name: "line", Type: "text"}}},
+		{Schema: "public", Name: "report", Kind: "view", Columns: []Column{{Name: "total", Type: "numeric"}}},
+	}}
+	to := &Schema{Tables: []Table{
+		{Schema: "public", Name: "orders", Kind: "table", Columns: []Column{
+			{Name: "id", Type: "integer"},
+			{Name: "client_id", Type: "integer"},
+			{Name: "total", Type: "numeric(12,2)"},
+			{Name: "comment", Type: "varchar(200)", Nullable: true},
+			{Name: "created_at", Type: "timestamp"},
+		}, ForeignKeys: []ForeignKey{clientFK}},
+		// renomeada com uma coluna a mais: 5 de 6 colunas iguais
+		{Schema: "public", Name: "clients", Kind: "table", Columns: []Column{
+			{Name: "id", Type: "integer"},
+			{Name: "name", Type: "text"},
+			{Name: "email", Type: "text"},
+			{Name: "phone", Type: "text"},
+			{Name: "city", Type: "text"},
+			{Name: "country", Type: "text"},
+		}},
+		// mesmas colunas da view removida, mas outro tipo de objeto
+		{Schema: "public", Name: "report_v2", Kind: "table", Columns: []Column{{Name: "total", Type: "numeric"}}},
+		{Schema: "public", Name: "events", Kind: "table", Columns: []Column{{Name: "at", Type: "timestamp"}}},
+	}}
+
+	got := Diff(from, to)
+	want := SchemaDiff{
+		AddedTables:   []string{"public.report_v2", "public.events"},
+		RemovedTables: []string{"public.logs", "public.report"},
+		RenamedTables: []Rename{{From: "public.customers", To: "public.clients"}},
+		ChangedTables: []TableDiff{
+			{Table: "public.clients", AddedColumns: []string{"country"}},
+			{
+				Table: "public.orders",
+				// customer_id → client_id e note → comment têm um único par
+				// possível; legacy e legacy2 não têm par e ficam removidas
+				AddedColumns:       []string{"created_at"},
+				RemovedColumns:     []string{"legacy", "legacy2"},
+				RenamedColumns:     []Rename{{From: "customer_id", To: "client_id"}, {From: "note", To: "comment"}},
+				TypeChanges:        []TypeChange{{Column: "total", From: "numeric(10,2)", To: "numeric(12,2)"}},
+				AddedForeignKeys:   []string{fkDefinition(clientFK)},
+				RemovedForeignKeys: []string{fkDefinition(customerFK)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got  %+v\nwant %+v", got, want)
+	}
+
+	gone := got.GoneTables()
+	if !reflect.DeepEqual(gone, []string{"public.logs", "public.report", "public.customers"}) {
+		t.Fatalf("GoneTables = %v", gone)
+	}
+	if !Diff(from, from).Empty() {
+		t.Fatal("o diff de um schema com ele mesmo deveria ser vazio")
+	}
+}
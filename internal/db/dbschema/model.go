@@ -0,0 +1,251 @@
+package dbschema
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+)
+
+// Schema é o banco como a política permite vê-lo. O DDL enviado ao LLM é
+// só uma das formas de mostrá-lo (ver RenderDDL).
+type Schema struct {
+	Enums  []Enum  `json:"enums,omitempty"`
+	Tables []Table `json:"tables"`
+}
+
+// Table descreve uma tabela ou view. Kind é "table", "view" ou
+// "materialized view"; Definition é o SELECT da view, presente só quando
+// configurado e sem restrições de visibilidade.
+type Table struct {
+	Schema      string       `json:"schema,omitempty"`
+	Name        string       `json:"name"`
+	Kind        string       `json:"kind"`
+	Comment     string       `json:"comment,omitempty"`
+	Columns     []Column     `json:"columns"`
+	PrimaryKey  []string     `json:"primary_key,omitempty"`
+	ForeignKeys []ForeignKey `json:"foreign_keys,omitempty"`
+	Constraints []Constraint `json:"constraints,omitempty"`
+	Indexes     []Index      `json:"indexes,omitempty"`
+	Definition  string       `json:"definition,omitempty"`
+}
+
+type Column struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Nullable  bool   `json:"nullable"`
+	Comment   string `json:"comment,omitempty"`
+	Default   string `json:"default,omitempty"`
+	Identity  string `json:"identity,omitempty"`
+	Generated string `json:"generated,omitempty"`
+}
+
+// ForeignKey é uma FK com os pares de colunas na ordem da constraint:
+// Columns[i] referencia RefColumns[i]. OnDelete fica vazio para NO ACTION.
+type ForeignKey struct {
+	Name       string   `json:"name,omitempty"`
+	Columns    []string `json:"columns"`
+	RefSchema  string   `json:"ref_schema,omitempty"`
+	RefTable   string   `json:"ref_table"`
+	RefColumns []string `json:"ref_columns"`
+	OnDelete   string   `json:"on_delete,omitempty"`
+}
+
+// RefName devolve o nome qualificado da tabela referenciada.
+func (fk ForeignKey) RefName() string {
+	return tableRef{Schema: fk.RefSchema, Name: fk.RefTable}.String()
+}
+
+// Constraint é uma constraint UNIQUE ou CHECK. Definition vem pronta do
+// banco ("UNIQUE (a, b)", "CHECK (x > 0)"); Columns pode ficar vazio quando o
+// dialeto não informa as colunas envolvidas.
+type Constraint struct {
+	Name       string   `json:"name"`
+	Definition string   `json:"definition"`
+	Columns    []string `json:"columns,omitempty"`
+}
+
+// Index é um índice que não sustenta a PK nem uma constraint; colunas que
+// são expressões aparecem como o texto da expressão.
+type Index struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+type Enum struct {
+	Schema string   `json:"schema,omitempty"`
+	Name   string   `json:"name"`
+	Labels []string `json:"labels"`
+}
+
+// QualifiedName devolve "schema.tabela", ou só o nome quando não há schema.
+func (t Table) QualifiedName() string {
+	return tableRef{Schema: t.Schema, Name: t.Name}.String()
+}
+
+// HasTable indica se o modelo tem a tabela ou view com o nome qualificado.
+func (s *Schema) HasTable(name string) bool {
+	for _, t := range s.Tables {
+		if t.QualifiedName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// QualifiedName devolve "schema.tipo", ou só o nome quando não há schema.
+func (e Enum) QualifiedName() string {
+	return tableRef{Schema: e.Schema, Name: e.Name}.String()
+}
+
+// Snapshot é o schema lido numa verificação. Hash identifica o conteúdo e
+// só muda quando alguma definição muda.
+type Snapshot struct {
+	Schema   *Schema   `json:"schema"`
+	Hash     string    `json:"hash"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// Schema devolve o modelo do último snapshot. O catálogo só é lido na
+// primeira chamada; depois o snapshot é atualizado por Watch, ListenDDL ou
+// DetectChanges. O modelo é compartilhado e não deve ser alterado.
+func (s *Service) Schema(ctx context.Context) (*Schema, error) {
+	snap, err := s.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return snap.Schema, nil
+}
+
+// Snapshot devolve o último snapshot, lendo o catálogo na primeira chamada.
+func (s *Service) Snapshot(ctx context.Context) (*Snapshot, error) {
+	s.mu.Lock()
+	snap := s.snapshot
+	s.mu.Unlock()
+	if snap != nil {
+		return snap, nil
+	}
+
+	snap, err := s.loadSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	stored := s.snapshot == nil
+	if stored {
+		s.snapshot = snap
+	}
+	snap = s.snapshot
+	s.mu.Unlock()
+
+	if stored {
+		s.saveSnapshot(snap)
+	}
+	return snap, nil
+}
+
+// ReadSnapshot lê o schema do banco agora, sem usar o snapshot em memória e
+// sem guardá-lo no histórico.
+func (s *Service) ReadSnapshot(ctx context.Context) (*Snapshot, error) {
+	return s.loadSnapshot(ctx)
+}
+
+// Snapshots devolve o histórico de snapshots, ou nil quando
+// SCHEMA_SNAPSHOT_DIR não está configurado.
+func (s *Service) Snapshots() *SnapshotStore {
+	return s.store
+}
+
+func (s *Service) saveSnapshot(snap *Snapshot) {
+	if s.store == nil {
+		return
+	}
+	if err := s.store.Save(snap); err != nil {
+		log.Printf("erro ao guardar snapshot do schema: %v", err)
+	}
+}
+
+func (s *Service) loadSnapshot(ctx context.Context) (*Snapshot, error) {
+	schema, err := s.readSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &Snapshot{Schema: schema, Hash: hex.EncodeToString(sum[:]), LoadedAt: time.Now()}, nil
+}
+
+// readSchema lê do catálogo os tipos enum, as tabelas e as views visíveis.
+func (s *Service) readSchema(ctx context.Context) (*Schema, error) {
+	enums, err := s.getEnums(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := s.getTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{Enums: enums, Tables: make([]Table, 0, len(refs))}
+	for _, ref := range refs {
+		t, err := s.describe(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		schema.Tables = append(schema.Tables, t)
+	}
+	return schema, nil
+}
+
+func (s *Service) describe(ctx context.Context, ref tableRef) (Table, error) {
+	columns, err := s.visibleColumns(ctx, ref)
+	if err != nil {
+		return Table{}, err
+	}
+
+	kind := strings.ToLower(string(ref.Kind))
+	if ref.Kind == kindTable {
+		kind = "table"
+	}
+	t := Table{Schema: ref.Schema, Name: ref.Name, Kind: kind, Columns: columns}
+
+	if tc, ok := s.intro.(tableCommenter); ok {
+		if t.Comment, err = tc.tableComment(ctx, ref); err != nil {
+			return Table{}, err
+		}
+	}
+
+	if ref.Kind != kindTable {
+		// a definição pode citar tabelas e colunas ocultas
+		if s.viewDefinitions && !s.policy.Restricted() {
+			if t.Definition, err = s.intro.(viewLister).viewDefinition(ctx, ref); err != nil {
+				return Table{}, err
+			}
+		}
+		return t, nil
+	}
+
+	if t.PrimaryKey, err = s.getPrimaryKey(ctx, ref); err != nil {
+		return Table{}, err
+	}
+	if t.ForeignKeys, err = s.getForeignKeys(ctx, ref); err != nil {
+		return Table{}, err
+	}
+	if t.Constraints, err = s.getConstraints(ctx, ref); err != nil {
+		return Table{}, err
+	}
+	if t.Indexes, err = s.getIndexes(ctx, ref); err != nil {
+		return Table{}, err
+	}
+	return t, nil
+}
@@ -0,0 +1,277 @@
+package dbschema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"rag-sql/internal/db"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlIntrospector lê o catálogo dos bancos configurados, que no MySQL
+// fazem o papel de schema. Sem nenhum configurado vale o banco selecionado
+// na conexão (DATABASE()), e as tabelas ficam sem qualificação.
+type mysqlIntrospector struct {
+	db db.Querier
+}
+
+// mysqlSchema é a condição de schema das consultas por tabela; o schema
+// vazio é o banco da conexão.
+const mysqlSchema = "TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE())"
+
+func (m *mysqlIntrospector) tables(ctx context.Context, schemas []string) ([]tableRef, error) {
+	return m.relations(ctx, schemas, "BASE TABLE", kindTable)
+}
+
+func (m *mysqlIntrospector) views(ctx context.Context, schemas []string) ([]tableRef, error) {
+	return m.relations(ctx, schemas, "VIEW", kindView)
+}
+
+func (m *mysqlIntrospector) relations(ctx context.Context, schemas []string, tableType string, kind relationKind) ([]tableRef, error) {
+	filter, args := "TABLE_SCHEMA = DATABASE()", []any{}
+	if len(schemas) > 0 {
+		filter = "TABLE_SCHEMA IN (?" + strings.Repeat(", ?", len(schemas)-1) + ")"
+		for _, schema := range schemas {
+			args = append(args, schema)
+		}
+	}
+
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT TABLE_SCHEMA, TABLE_NAME
+		FROM information_schema.TABLES
+		WHERE `+filter+` AND TABLE_TYPE = ?
+		ORDER BY TABLE_SCHEMA, TABLE_NAME
+	`, append(args, tableType)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []tableRef
+	for rows.Next() {
+		t := tableRef{Kind: kind}
+		if err := rows.Scan(&t.Schema, &t.Name); err != nil {
+			return nil, err
+		}
+		if len(schemas) == 0 {
+			t.Schema = ""
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func (m *mysqlIntrospector) viewDefinition(ctx context.Context, view tableRef) (string, error) {
+	var definition string
+	err := m.db.QueryRowContext(ctx, `
+		SELECT VIEW_DEFINITION
+		FROM information_schema.VIEWS
+		WHERE `+mysqlSchema+` AND TABLE_NAME = ?
+	`, view.Schema, view.Name).Scan(&definition)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return definition, err
+}
+
+// constraints lista só as CHECK; as UNIQUE já aparecem como índices únicos.
+// O catálogo não informa as colunas de cada CHECK.
+func (m *mysqlIntrospector) constraints(ctx context.Context, table tableRef) ([]Constraint, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT tc.CONSTRAINT_NAME, cc.CHECK_CLAUSE
+		FROM information_schema.TABLE_CONSTRAINTS tc
+		JOIN information_schema.CHECK_CONSTRAINTS cc
+		  ON cc.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND cc.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+		WHERE tc.`+mysqlSchema+` AND tc.TABLE_NAME = ? AND tc.CONSTRAINT_TYPE = 'CHECK'
+		ORDER BY tc.CONSTRAINT_NAME
+	`, table.Schema, table.Name)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errUnknownTable {
+		// versões anteriores ao MySQL 8.0.16 não têm CHECK_CONSTRAINTS
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var constraints []Constraint
+	for rows.Next() {
+		var name, clause string
+		if err := rows.Scan(&name, &clause); err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, Constraint{Name: name, Definition: "CHECK (" + clause + ")"})
+	}
+	return constraints, rows.Err()
+}
+
+// errUnknownTable é o ER_UNKNOWN_TABLE do MySQL.
+const errUnknownTable = 1109
+
+func (m *mysqlIntrospector) columns(ctx context.Context, table tableRef) ([]column, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_COMMENT,
+		       COLUMN_DEFAULT, EXTRA, COALESCE(GENERATION_EXPRESSION, '')
+		FROM information_schema.COLUMNS
+		WHERE `+mysqlSchema+` AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION
+	`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []column
+	for rows.Next() {
+		var c column
+		var isNullable, extra string
+		var def sql.NullString
+		if err := rows.Scan(&c.Name, &c.DataType, &isNullable, &c.Comment, &def, &extra, &c.Generated); err != nil {
+			return nil, err
+		}
+		c.Nullable = isNullable == "YES"
+		if def.Valid && c.Generated == "" {
+			c.Default = mysqlDefault(def.String, extra)
+		}
+		if strings.Contains(strings.ToLower(extra), "auto_increment") {
+			c.Identity = "AUTO_INCREMENT"
+		}
+		cols = append(cols, c)
+	}
+	return cols, rows.Err()
+}
+
+// mysqlDefault devolve o DEFAULT como expressão SQL. O MySQL informa
+// literais sem aspas e marca expressões com DEFAULT_GENERATED; o MariaDB já
+// põe as aspas nos literais e informa a ausência de default como "NULL".
+func mysqlDefault(value, extra string) string {
+	upper := strings.ToUpper(value)
+	switch {
+	case strings.Contains(strings.ToUpper(extra), "DEFAULT_GENERATED"),
+		strings.HasPrefix(value, "'"),
+		strings.HasPrefix(upper, "CURRENT_TIMESTAMP"):
+		return value
+	case upper == "NULL":
+		return ""
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func (m *mysqlIntrospector) primaryKey(ctx context.Context, table tableRef) ([]string, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE `+mysqlSchema+` AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'
+		ORDER BY ORDINAL_POSITION
+	`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pk []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		pk = append(pk, name)
+	}
+	return pk, rows.Err()
+}
+
+func (m *mysqlIntrospector) foreignKeys(ctx context.Context, table tableRef) ([]ForeignKey, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT k.CONSTRAINT_NAME, k.COLUMN_NAME,
+		       IF(k.REFERENCED_TABLE_SCHEMA = k.TABLE_SCHEMA, ?, k.REFERENCED_TABLE_SCHEMA),
+		       k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, r.DELETE_RULE
+		FROM information_schema.KEY_COLUMN_USAGE k
+		JOIN information_schema.REFERENTIAL_CONSTRAINTS r
+		  ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+		WHERE k.`+mysqlSchema+` AND k.TABLE_NAME = ?
+		  AND k.REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY k.CONSTRAINT_NAME, k.ORDINAL_POSITION
+	`, table.Schema, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []ForeignKey
+	for rows.Next() {
+		var fk ForeignKey
+		var col, refCol, onDelete string
+		if err := rows.Scan(&fk.Name, &col, &fk.RefSchema, &fk.RefTable, &refCol, &onDelete); err != nil {
+			return nil, err
+		}
+		if n := len(fks); n > 0 && fks[n-1].Name == fk.Name {
+			fks[n-1].Columns = append(fks[n-1].Columns, col)
+			fks[n-1].RefColumns = append(fks[n-1].RefColumns, refCol)
+			continue
+		}
+		fk.Columns, fk.RefColumns, fk.OnDelete = []string{col}, []string{refCol}, onDeleteAction(onDelete)
+		fks = append(fks, fk)
+	}
+	return fks, rows.Err()
+}
+
+func (m *mysqlIntrospector) indexes(ctx context.Context, table tableRef) ([]Index, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT INDEX_NAME, NON_UNIQUE, COLUMN_NAME
+		FROM information_schema.STATISTICS
+		WHERE `+mysqlSchema+` AND TABLE_NAME = ?
+		  AND INDEX_NAME <> 'PRIMARY' AND COLUMN_NAME IS NOT NULL
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX
+	`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []Index
+	for rows.Next() {
+		var name, col string
+		var nonUnique int
+		if err := rows.Scan(&name, &nonUnique, &col); err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, col)
+			continue
+		}
+		indexes = append(indexes, Index{Name: name, Columns: []string{col}, Unique: nonUnique == 0})
+	}
+	return indexes, rows.Err()
+}
+
+func (m *mysqlIntrospector) tableComment(ctx context.Context, table tableRef) (string, error) {
+	// views têm sempre o comentário "VIEW"
+	if table.Kind != kindTable {
+		return "", nil
+	}
+
+	var comment sql.NullString
+	err := m.db.QueryRowContext(ctx, `
+		SELECT TABLE_COMMENT
+		FROM information_schema.TABLES
+		WHERE `+mysqlSchema+` AND TABLE_NAME = ?
+	`, table.Schema, table.Name).Scan(&comment)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// tabelas InnoDB antigas guardam metadados do engine no comentário
+	if strings.HasPrefix(comment.String, "InnoDB free:") {
+		return "", nil
+	}
+	return comment.String, nil
+}
@@ -0,0 +1,86 @@
+package dbschema
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// getEnums lista os tipos enum, para que o modelo saiba quais valores as
+// colunas desses tipos aceitam.
+func (s *Service) getEnums(ctx context.Context) ([]Enum, error) {
+	el, ok := s.intro.(enumLister)
+	if !ok {
+		return nil, nil
+	}
+	return el.enums(ctx, s.schemas)
+}
+
+// ViewDependencies devolve, por nome qualificado, as tabelas lidas por cada
+// view, inclusive através de outras views. Quando o dialeto informa as
+// dependências, entram as views de todos os schemas, não só dos lidos: uma
+// view fora deles também pode ser consultada. Nos outros dialetos as views
+// visíveis ficam com nil.
+func (s *Service) ViewDependencies(ctx context.Context) (map[string][]string, error) {
+	if dr, ok := s.intro.(viewDependencyReader); ok {
+		views, err := dr.viewTables(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler dependências das views: %w", err)
+		}
+		deps := make(map[string][]string, len(views))
+		for v, tables := range views {
+			// views ocultas são recusadas na execução de qualquer forma
+			if !s.policy.TableVisible(v.Schema, v.Name) {
+				continue
+			}
+			names := make([]string, len(tables))
+			for i, t := range tables {
+				names[i] = t.String()
+			}
+			deps[v.String()] = names
+		}
+		return deps, nil
+	}
+
+	vl, ok := s.intro.(viewLister)
+	if !ok {
+		return nil, nil
+	}
+	views, err := vl.views(ctx, s.schemas)
+	if err != nil {
+		return nil, err
+	}
+	deps := map[string][]string{}
+	for _, v := range views {
+		if s.policy.TableVisible(v.Schema, v.Name) {
+			deps[v.String()] = nil
+		}
+	}
+	return deps, nil
+}
+
+func (s *Service) getConstraints(ctx context.Context, table tableRef) ([]Constraint, error) {
+	cl, ok := s.intro.(constraintLister)
+	if !ok {
+		return nil, nil
+	}
+
+	constraints, err := cl.constraints(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var visible []Constraint
+	for _, c := range constraints {
+		// sem a lista de colunas a constraint pode citar uma coluna oculta
+		if len(c.Columns) == 0 && s.policy.HasColumnRestrictions(table.Schema, table.Name) {
+			continue
+		}
+		if !s.columnsVisible(table, c.Columns) {
+			continue
+		}
+		c.Definition = strings.Join(strings.Fields(c.Definition), " ")
+		visible = append(visible, c)
+	}
+	return visible, nil
+}
@@ -0,0 +1,77 @@
+package dbschema
+
+import (
+	"context"
+	"rag-sql/internal/config"
+	"reflect"
+	"testing"
+)
+
+// fakeIntrospector devolve um catálogo fixo, sem banco.
+type fakeIntrospector struct {
+	tableRefs []tableRef
+	viewDeps  map[tableRef][]tableRef
+}
+
+func (f *fakeIntrospector) tables(ctx context.Context, schemas []string) ([]tableRef, error) {
+	return f.tableRefs, nil
+}
+
+func (f *fakeIntrospector) columns(ctx context.Context, table tableRef) ([]column, error) {
+	return []column{{Name: "id", DataType: "integer"}}, nil
+}
+
+func (f *fakeIntrospector) primaryKey(ctx context.Context, table tableRef) ([]string, error) {
+	return nil, nil
+}
+
+func (f *fakeIntrospector) foreignKeys(ctx context.Context, table tableRef) ([]ForeignKey, error) {
+	return nil, nil
+}
+
+func (f *fakeIntrospector) viewTables(ctx context.Context) (map[tableRef][]tableRef, error) {
+	return f.viewDeps, nil
+}
+
+func TestViewDependencies(t *testing.T) {
+	intro := &fakeIntrospector{viewDeps: map[tableRef][]tableRef{
+		{Schema: "public", Name: "report"}: {{Schema: "public", Name: "orders"}},
+		// fora dos schemas lidos, mas consultável pelo nome qualificado
+		{Schema: "archive", Name: "history"}:  {{Schema: "public", Name: "orders"}, {Schema: "archive", Name: "users"}},
+		{Schema: "public", Name: "constants"}: {},
+		{Schema: "public", Name: "hidden"}:    {{Schema: "public", Name: "orders"}},
+	}}
+	s := &Service{intro: intro, schemas: []string{"public"}, policy: config.SchemaPolicy{DenyTables: []string{"hidden"}}}
+
+	got, err := s.ViewDependencies(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"public.report":    {"public.orders"},
+		"archive.history":  {"public.orders", "archive.users"},
+		"public.constants": {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestDetectChangesCallsOnRefresh(t *testing.T) {
+	s := &Service{intro: &fakeIntrospector{tableRefs: []tableRef{{Schema: "public", Name: "orders", Kind: kindTable}}}}
+
+	refreshes, changes := 0, 0
+	s.OnRefresh(func() { refreshes++ })
+	s.OnChange(func([]string) { changes++ })
+
+	// o modelo não muda entre as leituras, mas a consulta de uma view pode
+	// ter mudado
+	for range 3 {
+		if err := s.DetectChanges(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if refreshes != 3 || changes != 0 {
+		t.Fatalf("refreshes = %d, changes = %d; want 3, 0", refreshes, changes)
+	}
+}
@@ -0,0 +1,401 @@
+package dbschema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"rag-sql/internal/db"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type postgresIntrospector struct {
+	db db.Querier
+}
+
+func (p *postgresIntrospector) tables(ctx context.Context, schemas []string) ([]tableRef, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT table_schema, table_name
+		FROM information_schema.tables
+		WHERE table_schema::text = ANY($1) AND table_type = 'BASE TABLE'
+		ORDER BY table_schema, table_name
+	`, pq.Array(schemas))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []tableRef
+	for rows.Next() {
+		var t tableRef
+		if err := rows.Scan(&t.Schema, &t.Name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// columns lê as colunas do pg_attribute na ordem da tabela. O tipo vem do
+// format_type, com tamanho, precisão e o tipo dos elementos dos arrays; tipos
+// de fora do search_path vêm com o schema.
+func (p *postgresIntrospector) columns(ctx context.Context, table tableRef) ([]column, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT a.attname,
+		       format_type(a.atttypid, a.atttypmod),
+		       NOT a.attnotnull,
+		       COALESCE(col_description(a.attrelid, a.attnum), ''),
+		       CASE WHEN a.attgenerated = '' THEN COALESCE(pg_get_expr(d.adbin, d.adrelid), '') ELSE '' END,
+		       CASE a.attidentity
+		           WHEN 'a' THEN 'GENERATED ALWAYS AS IDENTITY'
+		           WHEN 'd' THEN 'GENERATED BY DEFAULT AS IDENTITY'
+		           ELSE ''
+		       END,
+		       CASE WHEN a.attgenerated <> '' THEN COALESCE(pg_get_expr(d.adbin, d.adrelid), '') ELSE '' END
+		FROM pg_attribute a
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = format('%I.%I', $1::text, $2::text)::regclass
+		  AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum
+	`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []column
+	for rows.Next() {
+		var c column
+		if err := rows.Scan(&c.Name, &c.DataType, &c.Nullable, &c.Comment, &c.Default, &c.Identity, &c.Generated); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, rows.Err()
+}
+
+func (p *postgresIntrospector) primaryKey(ctx context.Context, table tableRef) ([]string, error) {
+	var pk sql.NullString
+	err := p.db.QueryRowContext(ctx, `
+	SELECT string_agg(a.attname, ', ')
+	FROM pg_index i
+	JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+	WHERE i.indrelid = format('%I.%I', $1::text, $2::text)::regclass AND i.indisprimary
+`, table.Schema, table.Name).Scan(&pk)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !pk.Valid {
+		return nil, nil
+	}
+
+	return strings.Split(pk.String, ", "), nil
+}
+
+// foreignKeys lê as FKs do pg_constraint, com as colunas de conkey e
+// confkey na mesma ordem.
+func (p *postgresIntrospector) foreignKeys(ctx context.Context, table tableRef) ([]ForeignKey, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT con.conname, rn.nspname, rc.relname,
+		       ARRAY(
+		           SELECT a.attname
+		           FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+		           JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		           ORDER BY k.ord
+		       )::text[],
+		       ARRAY(
+		           SELECT a.attname
+		           FROM unnest(con.confkey) WITH ORDINALITY AS k(attnum, ord)
+		           JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum
+		           ORDER BY k.ord
+		       )::text[],
+		       CASE con.confdeltype
+		           WHEN 'r' THEN 'RESTRICT'
+		           WHEN 'c' THEN 'CASCADE'
+		           WHEN 'n' THEN 'SET NULL'
+		           WHEN 'd' THEN 'SET DEFAULT'
+		           ELSE ''
+		       END
+		FROM pg_constraint con
+		JOIN pg_class rc ON rc.oid = con.confrelid
+		JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+		WHERE con.conrelid = format('%I.%I', $1::text, $2::text)::regclass AND con.contype = 'f'
+		ORDER BY con.conname
+	`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []ForeignKey
+	for rows.Next() {
+		var fk ForeignKey
+		if err := rows.Scan(&fk.Name, &fk.RefSchema, &fk.RefTable, pq.Array(&fk.Columns), pq.Array(&fk.RefColumns), &fk.OnDelete); err != nil {
+			return nil, err
+		}
+		fks = append(fks, fk)
+	}
+	return fks, rows.Err()
+}
+
+func (p *postgresIntrospector) views(ctx context.Context, schemas []string) ([]tableRef, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT n.nspname, c.relname, c.relkind = 'm'
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('v', 'm') AND n.nspname = ANY($1)
+		ORDER BY n.nspname, c.relname
+	`, pq.Array(schemas))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []tableRef
+	for rows.Next() {
+		v := tableRef{Kind: kindView}
+		var materialized bool
+		if err := rows.Scan(&v.Schema, &v.Name, &materialized); err != nil {
+			return nil, err
+		}
+		if materialized {
+			v.Kind = kindMaterializedView
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+func (p *postgresIntrospector) viewDefinition(ctx context.Context, view tableRef) (string, error) {
+	var definition string
+	err := p.db.QueryRowContext(ctx, `
+		SELECT pg_get_viewdef(format('%I.%I', $1::text, $2::text)::regclass, true)
+	`, view.Schema, view.Name).Scan(&definition)
+	return definition, err
+}
+
+// viewTables segue as regras de reescrita das views (pg_rewrite) até as
+// tabelas, atravessando views que leem outras views. Entram as views de
+// todos os schemas que não são do sistema.
+func (p *postgresIntrospector) viewTables(ctx context.Context) (map[tableRef][]tableRef, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		WITH RECURSIVE deps(view, oid) AS (
+			SELECT c.oid, c.oid
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE c.relkind IN ('v', 'm')
+			  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+			  AND n.nspname NOT LIKE 'pg\_toast%'
+			UNION
+			SELECT deps.view, d.refobjid
+			FROM deps
+			JOIN pg_rewrite r ON r.ev_class = deps.oid
+			JOIN pg_depend d ON d.classid = 'pg_rewrite'::regclass AND d.objid = r.oid
+				AND d.refclassid = 'pg_class'::regclass AND d.refobjid <> deps.oid
+		)
+		SELECT vn.nspname, v.relname, tn.nspname, t.relname
+		FROM deps
+		JOIN pg_class v ON v.oid = deps.view
+		JOIN pg_namespace vn ON vn.oid = v.relnamespace
+		LEFT JOIN pg_class t ON t.oid = deps.oid AND t.relkind IN ('r', 'p', 'f')
+		LEFT JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		ORDER BY 1, 2, 3, 4
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := map[tableRef][]tableRef{}
+	for rows.Next() {
+		var view tableRef
+		var schema, name sql.NullString
+		if err := rows.Scan(&view.Schema, &view.Name, &schema, &name); err != nil {
+			return nil, err
+		}
+		// a própria view e as views intermediárias vêm sem tabela
+		if !name.Valid {
+			if _, ok := views[view]; !ok {
+				views[view] = []tableRef{}
+			}
+			continue
+		}
+		views[view] = append(views[view], tableRef{Schema: schema.String, Name: name.String})
+	}
+	return views, rows.Err()
+}
+
+func (p *postgresIntrospector) enums(ctx context.Context, schemas []string) ([]Enum, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT n.nspname, t.typname, e.enumlabel
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		JOIN pg_enum e ON e.enumtypid = t.oid
+		WHERE n.nspname = ANY($1)
+		ORDER BY n.nspname, t.typname, e.enumsortorder
+	`, pq.Array(schemas))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var enums []Enum
+	for rows.Next() {
+		var schema, name, label string
+		if err := rows.Scan(&schema, &name, &label); err != nil {
+			return nil, err
+		}
+		if n := len(enums); n > 0 && enums[n-1].Schema == schema && enums[n-1].Name == name {
+			enums[n-1].Labels = append(enums[n-1].Labels, label)
+			continue
+		}
+		enums = append(enums, Enum{Schema: schema, Name: name, Labels: []string{label}})
+	}
+	return enums, rows.Err()
+}
+
+func (p *postgresIntrospector) constraints(ctx context.Context, table tableRef) ([]Constraint, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT con.conname, pg_get_constraintdef(con.oid, true),
+		       ARRAY(
+		           SELECT a.attname
+		           FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+		           JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		           ORDER BY k.ord
+		       )::text[]
+		FROM pg_constraint con
+		WHERE con.conrelid = format('%I.%I', $1::text, $2::text)::regclass
+		  AND con.contype IN ('u', 'c')
+		ORDER BY con.contype DESC, con.conname
+	`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var constraints []Constraint
+	for rows.Next() {
+		var c Constraint
+		if err := rows.Scan(&c.Name, &c.Definition, pq.Array(&c.Columns)); err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints, rows.Err()
+}
+
+// indexes lista os índices que não sustentam constraints (a chave primária
+// e as UNIQUE já aparecem no CREATE TABLE). Colunas de índices por expressão
+// vêm como a própria expressão.
+func (p *postgresIntrospector) indexes(ctx context.Context, table tableRef) ([]Index, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT c.relname, ix.indisunique, pg_get_indexdef(ix.indexrelid, k.n, true)
+		FROM pg_index ix
+		JOIN pg_class c ON c.oid = ix.indexrelid
+		CROSS JOIN LATERAL generate_series(1, ix.indnkeyatts) AS k(n)
+		WHERE ix.indrelid = format('%I.%I', $1::text, $2::text)::regclass
+		  AND NOT EXISTS (
+		      SELECT 1 FROM pg_constraint con
+		      WHERE con.conrelid = ix.indrelid AND con.conindid = ix.indexrelid
+		  )
+		ORDER BY c.relname, k.n
+	`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []Index
+	for rows.Next() {
+		var name, col string
+		var unique bool
+		if err := rows.Scan(&name, &unique, &col); err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, col)
+			continue
+		}
+		indexes = append(indexes, Index{Name: name, Columns: []string{col}, Unique: unique})
+	}
+	return indexes, rows.Err()
+}
+
+func (p *postgresIntrospector) tableComment(ctx context.Context, table tableRef) (string, error) {
+	var comment sql.NullString
+	err := p.db.QueryRowContext(ctx, `
+		SELECT obj_description(format('%I.%I', $1::text, $2::text)::regclass, 'pg_class')
+	`, table.Schema, table.Name).Scan(&comment)
+	return comment.String, err
+}
+
+// sampleSource usa TABLESAMPLE SYSTEM nas tabelas maiores que a amostra,
+// com a porcentagem tirada da estimativa de linhas do catálogo. Sem
+// estimativa (tabela nunca analisada) a amostra são as primeiras linhas.
+func (p *postgresIntrospector) sampleSource(ctx context.Context, table tableRef, rows int) (string, error) {
+	var estimate float64
+	err := p.db.QueryRowContext(ctx, `
+		SELECT reltuples FROM pg_class
+		WHERE oid = format('%I.%I', $1::text, $2::text)::regclass
+	`, table.Schema, table.Name).Scan(&estimate)
+	if err != nil {
+		return "", err
+	}
+
+	name := pq.QuoteIdentifier(table.Schema) + "." + pq.QuoteIdentifier(table.Name)
+	switch {
+	case estimate < 0:
+		return fmt.Sprintf("(SELECT * FROM %s LIMIT %d) AS amostra", name, rows), nil
+	case estimate <= float64(rows):
+		return name, nil
+	}
+	percent := float64(rows) * 100 / estimate
+	return fmt.Sprintf("%s TABLESAMPLE SYSTEM (%s)", name, strconv.FormatFloat(percent, 'f', 6, 64)), nil
+}
+
+// tableStats lê reltuples e pg_stats. n_distinct negativo é uma fração das
+// linhas; nas tabelas particionadas só existem as estatísticas com
+// inherited, que valem para a hierarquia toda.
+func (p *postgresIntrospector) tableStats(ctx context.Context, table tableRef) (TableStats, error) {
+	var stats TableStats
+	err := p.db.QueryRowContext(ctx, `
+		SELECT greatest(reltuples, 0) FROM pg_class
+		WHERE oid = format('%I.%I', $1::text, $2::text)::regclass
+	`, table.Schema, table.Name).Scan(&stats.EstimatedRows)
+	if err != nil {
+		return stats, err
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (attname) attname, null_frac, n_distinct,
+		       COALESCE(most_common_vals::text::text[], '{}'),
+		       COALESCE(histogram_bounds::text::text[], '{}')
+		FROM pg_stats
+		WHERE schemaname = $1 AND tablename = $2
+		ORDER BY attname, inherited DESC
+	`, table.Schema, table.Name)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c ColumnStats
+		var bounds []string
+		if err := rows.Scan(&c.Column, &c.NullFraction, &c.Distinct, pq.Array(&c.CommonValues), pq.Array(&bounds)); err != nil {
+			return stats, err
+		}
+		if c.Distinct < 0 {
+			c.Distinct = -c.Distinct * stats.EstimatedRows
+		}
+		if len(bounds) > 0 {
+			c.Min, c.Max = bounds[0], bounds[len(bounds)-1]
+		}
+		stats.Columns = append(stats.Columns, c)
+	}
+	return stats, rows.Err()
+}
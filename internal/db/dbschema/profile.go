@@ -0,0 +1,378 @@
+package dbschema
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-sql/internal/db/dialect"
+	"rag-sql/internal/db/pii"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ColumnProfile resume os valores reais de uma coluna, tirados das
+// estatísticas do banco ou de uma amostra da tabela: os valores distintos
+// das colunas de texto com poucos valores ou o intervalo das numéricas e de
+// data.
+type ColumnProfile struct {
+	Column string   `json:"column"`
+	Values []string `json:"values,omitempty"`
+	Min    string   `json:"min,omitempty"`
+	Max    string   `json:"max,omitempty"`
+}
+
+// tableSampler devolve a origem do FROM que lê só uma amostra de cerca de
+// rows linhas. Sem ele a amostra são as primeiras linhas que o banco ler.
+type tableSampler interface {
+	sampleSource(ctx context.Context, table tableRef, rows int) (string, error)
+}
+
+const (
+	// profileTimeout limita a coleta de cada tabela.
+	profileTimeout = time.Minute
+	// valores mais longos indicam texto livre, que não vale listar
+	maxProfileValueLen = 64
+)
+
+type profileKind int
+
+const (
+	profileNone profileKind = iota
+	profileValues
+	profileRange
+)
+
+// ColumnProfiles devolve os perfis das colunas da tabela, pelo nome
+// qualificado ou só pelo nome no schema padrão. Fica vazio até a primeira
+// coleta terminar.
+func (s *Service) ColumnProfiles(table string) []ColumnProfile {
+	key := strings.ToLower(parseTableRef(table, s.defaultSchema).String())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profiles[key]
+}
+
+// WatchProfiles coleta os perfis logo de início e de novo a cada intervalo
+// até o contexto ser cancelado.
+func (s *Service) WatchProfiles(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ProfileValues(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("erro ao coletar valores das colunas: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProfileValues coleta as estatísticas e os perfis das colunas visíveis de
+// todas as tabelas. Uma tabela que falha fica sem perfil e não interrompe
+// as demais.
+func (s *Service) ProfileValues(ctx context.Context) error {
+	tables, err := s.getTables(ctx)
+	if err != nil {
+		return err
+	}
+
+	enums, err := s.enumNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	profiles := map[string][]ColumnProfile{}
+	stats := map[string]TableStats{}
+	for _, table := range tables {
+		if table.Kind != kindTable {
+			continue
+		}
+
+		tableStats, tableProfiles, err := s.profileTable(ctx, table, enums)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("erro ao coletar valores de %s: %v", table, err)
+			continue
+		}
+		key := strings.ToLower(table.String())
+		if tableStats != nil {
+			stats[key] = *tableStats
+		}
+		if len(tableProfiles) > 0 {
+			profiles[key] = tableProfiles
+		}
+	}
+
+	s.mu.Lock()
+	s.profiles = profiles
+	s.stats = stats
+	s.mu.Unlock()
+	return nil
+}
+
+// profileTable lê as estatísticas da tabela, quando o dialeto as tem, e
+// monta os perfis das colunas a partir delas. Só as colunas sem estatísticas
+// são lidas de uma amostra.
+func (s *Service) profileTable(ctx context.Context, table tableRef, enums map[string]bool) (*TableStats, []ColumnProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, profileTimeout)
+	defer cancel()
+
+	var tableStats *TableStats
+	stats, ok, err := s.readStats(ctx, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		tableStats = &stats
+	}
+	if s.profileExcluded(table, "") {
+		return tableStats, nil, nil
+	}
+
+	columns, err := s.visibleColumns(ctx, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	// chaves e identidades são identificadores sem significado para filtros
+	pk, err := s.intro.primaryKey(ctx, table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var profiles []ColumnProfile
+	var from string
+	for _, c := range columns {
+		if c.Identity != "" || slices.Contains(pk, c.Name) || s.profileExcluded(table, c.Name) || s.profileMasked(c.Name) {
+			continue
+		}
+		kind := profileKindOf(c.Type, enums)
+		if kind == profileNone {
+			continue
+		}
+
+		if cs, ok := stats.column(c.Name); ok {
+			if p, ok := s.profileFromStats(cs, kind); ok && !s.profileMasked(c.Name, p.values()...) {
+				profiles = append(profiles, p)
+			}
+			continue
+		}
+
+		if from == "" {
+			if from, err = s.sampleSource(ctx, table); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		var p ColumnProfile
+		if kind == profileValues {
+			p, ok, err = s.profileDistinct(ctx, from, c.Name)
+		} else {
+			p, ok, err = s.profileRange(ctx, from, c.Name)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("coluna %s: %w", c.Name, err)
+		}
+		if ok && !s.profileMasked(c.Name, p.values()...) {
+			profiles = append(profiles, p)
+		}
+	}
+	return tableStats, profiles, nil
+}
+
+// profileFromStats monta o perfil sem ler a tabela; ok é falso quando as
+// estatísticas mostram que a coluna não é uma categoria ou não têm os
+// extremos.
+func (s *Service) profileFromStats(c ColumnStats, kind profileKind) (ColumnProfile, bool) {
+	p := ColumnProfile{Column: c.Column}
+	if kind == profileRange {
+		p.Min, p.Max = c.Min, c.Max
+		return p, c.Min != ""
+	}
+
+	if c.Distinct <= 0 || c.Distinct > float64(s.profileMaxValues) || len(c.CommonValues) == 0 {
+		return p, false
+	}
+	for _, v := range c.CommonValues {
+		if utf8.RuneCountInString(v) > maxProfileValueLen {
+			return p, false
+		}
+	}
+	p.Values = c.CommonValues
+	return p, true
+}
+
+func (s *Service) sampleSource(ctx context.Context, table tableRef) (string, error) {
+	if ts, ok := s.intro.(tableSampler); ok {
+		return ts.sampleSource(ctx, table, s.profileSampleRows)
+	}
+	return fmt.Sprintf("(SELECT * FROM %s LIMIT %d) AS amostra", s.quoteTable(table), s.profileSampleRows), nil
+}
+
+func (s *Service) quoteTable(table tableRef) string {
+	name := dialect.QuoteIdent(s.dialect, table.Name)
+	if table.Schema == "" {
+		return name
+	}
+	return dialect.QuoteIdent(s.dialect, table.Schema) + "." + name
+}
+
+// profileDistinct lista os valores mais frequentes da coluna; ok é falso
+// quando ela tem valores demais ou longos demais para ser uma categoria.
+func (s *Service) profileDistinct(ctx context.Context, from, column string) (ColumnProfile, bool, error) {
+	col := dialect.QuoteIdent(s.dialect, column)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s, count(*) FROM %s WHERE %s IS NOT NULL GROUP BY %s ORDER BY 2 DESC, 1 LIMIT %d",
+		col, from, col, col, s.profileMaxValues+1,
+	))
+	if err != nil {
+		return ColumnProfile{}, false, err
+	}
+	defer rows.Close()
+
+	p := ColumnProfile{Column: column}
+	for rows.Next() {
+		var value any
+		var count int64
+		if err := rows.Scan(&value, &count); err != nil {
+			return ColumnProfile{}, false, err
+		}
+		v := profileValue(value)
+		if utf8.RuneCountInString(v) > maxProfileValueLen {
+			return ColumnProfile{}, false, nil
+		}
+		p.Values = append(p.Values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return ColumnProfile{}, false, err
+	}
+	ok := len(p.Values) > 0 && len(p.Values) <= s.profileMaxValues
+	return p, ok, nil
+}
+
+func (s *Service) profileRange(ctx context.Context, from, column string) (ColumnProfile, bool, error) {
+	col := dialect.QuoteIdent(s.dialect, column)
+	var minValue, maxValue any
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT min(%s), max(%s) FROM %s", col, col, from)).Scan(&minValue, &maxValue)
+	if err != nil {
+		return ColumnProfile{}, false, err
+	}
+	if minValue == nil || maxValue == nil {
+		return ColumnProfile{}, false, nil
+	}
+	return ColumnProfile{Column: column, Min: profileValue(minValue), Max: profileValue(maxValue)}, true, nil
+}
+
+// profileValue formata o valor como aparece num literal SQL; datas à meia
+// noite ficam só com a data.
+func profileValue(v any) string {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.DateTime)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// profileKindOf decide pelo tipo declarado o que coletar da coluna; enums
+// são os nomes dos tipos enum do banco.
+func profileKindOf(dataType string, enums map[string]bool) profileKind {
+	t := strings.ToLower(strings.TrimSpace(dataType))
+	base, _, _ := strings.Cut(t, "(")
+	base = strings.TrimSpace(base)
+
+	switch {
+	case base == "" || strings.HasPrefix(base, "interval"):
+		return profileNone
+	case enums[strings.ReplaceAll(base, `"`, "")], base == "enum", base == "set":
+		return profileValues
+	case strings.Contains(base, "char"), strings.Contains(base, "text"):
+		return profileValues
+	}
+
+	for _, prefix := range []string{"date", "time", "year"} {
+		if strings.HasPrefix(base, prefix) {
+			return profileRange
+		}
+	}
+	for _, prefix := range []string{"int", "smallint", "bigint", "tinyint", "mediumint", "numeric", "decimal", "real", "double", "float", "serial", "bigserial", "smallserial", "money"} {
+		if strings.HasPrefix(base, prefix) {
+			return profileRange
+		}
+	}
+	return profileNone
+}
+
+// enumNames devolve os nomes dos tipos enum, com e sem o schema, como
+// aparecem no tipo das colunas.
+func (s *Service) enumNames(ctx context.Context) (map[string]bool, error) {
+	names := map[string]bool{}
+	el, ok := s.intro.(enumLister)
+	if !ok {
+		return names, nil
+	}
+
+	enums, err := el.enums(ctx, s.schemas)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range enums {
+		names[strings.ToLower(e.Name)] = true
+		names[strings.ToLower(tableRef{Schema: e.Schema, Name: e.Name}.String())] = true
+	}
+	return names, nil
+}
+
+// profileExcluded indica se a configuração exclui a tabela inteira ou, com
+// column não vazio, a coluna.
+func (s *Service) profileExcluded(table tableRef, column string) bool {
+	keys := []string{strings.ToLower(table.Name), strings.ToLower(table.String())}
+	if column != "" {
+		column = strings.ToLower(column)
+		keys = []string{"*." + column, keys[0] + "." + column, keys[1] + "." + column}
+	}
+	return slices.ContainsFunc(s.profileExclude, func(key string) bool {
+		return slices.Contains(keys, strings.ToLower(key))
+	})
+}
+
+// profileMasked indica se o mascaramento reconheceria a coluna, pelo nome ou
+// pelos valores, como de um tipo semântico mascarado em alguma política.
+func (s *Service) profileMasked(column string, values ...string) bool {
+	if len(s.profileSemantic) == 0 {
+		return false
+	}
+	sample := make([]any, len(values))
+	for i, v := range values {
+		sample[i] = v
+	}
+	semantic := pii.Detect(column, sample)
+	return semantic != "" && slices.Contains(s.profileSemantic, semantic)
+}
+
+func (p ColumnProfile) values() []string {
+	values := slices.Clone(p.Values)
+	for _, v := range []string{p.Min, p.Max} {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,33 @@
+package dbschema
+
+import "testing"
+
+func TestProfileMasked(t *testing.T) {
+	s := &Service{profileSemantic: []string{"email", "cpf"}}
+
+	tests := []struct {
+		name   string
+		column string
+		values []string
+		want   bool
+	}{
+		{"nome de email", "contact_email", nil, true},
+		{"nome de cpf", "CPF", nil, true},
+		{"valores de email", "contato", []string{"ana@example.com", "bia@example.com"}, true},
+		{"valores de cpf", "documento", []string{"123.456.789-09", "987.654.321-00"}, true},
+		{"tipo não mascarado", "telefone", []string{"11 91234-5678"}, false},
+		{"coluna comum", "status", []string{"pago", "pendente"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.profileMasked(tt.column, tt.values...); got != tt.want {
+				t.Fatalf("profileMasked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if (&Service{}).profileMasked("email") {
+		t.Fatal("sem tipos mascarados nada deveria ser excluído")
+	}
+}
@@ -0,0 +1,142 @@
+package dbschema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenderDDL descreve o schema como CREATE TYPE, CREATE TABLE e CREATE VIEW,
+// um bloco por objeto separado por linha em branco. Os comentários vão como
+// comentários SQL de fim de linha.
+func RenderDDL(schema *Schema) string {
+	var blocks []string
+	for _, e := range schema.Enums {
+		blocks = append(blocks, RenderEnum(e))
+	}
+	for _, t := range schema.Tables {
+		blocks = append(blocks, RenderTable(t))
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+func RenderEnum(e Enum) string {
+	labels := make([]string, len(e.Labels))
+	for i, label := range e.Labels {
+		labels[i] = "'" + strings.ReplaceAll(label, "'", "''") + "'"
+	}
+	return fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);", e.QualifiedName(), strings.Join(labels, ", "))
+}
+
+func RenderTable(t Table) string {
+	var lines, comments []string
+	for _, c := range t.Columns {
+		lines = append(lines, columnDef(c))
+		comments = append(comments, c.Comment)
+	}
+
+	if t.Kind != "table" {
+		stmt := fmt.Sprintf("CREATE %s %s (%s\n", strings.ToUpper(t.Kind), t.QualifiedName(), sqlComment(t.Comment))
+		stmt += renderBody(lines, comments)
+		stmt += "\n)"
+		if definition := compactDefinition(t.Definition); definition != "" {
+			stmt += " AS\n" + definition
+		}
+		return stmt + ";"
+	}
+
+	if len(t.PrimaryKey) > 0 {
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(t.PrimaryKey, ", ")))
+	}
+
+	for _, fk := range t.ForeignKeys {
+		lines = append(lines, fkDefinition(fk))
+	}
+
+	for _, c := range t.Constraints {
+		lines = append(lines, fmt.Sprintf("CONSTRAINT %s %s", c.Name, c.Definition))
+	}
+
+	for _, idx := range t.Indexes {
+		kind := "INDEX"
+		if idx.Unique {
+			kind = "UNIQUE INDEX"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s (%s)", kind, idx.Name, strings.Join(idx.Columns, ", ")))
+	}
+
+	stmt := fmt.Sprintf("CREATE TABLE %s (%s\n", t.QualifiedName(), sqlComment(t.Comment))
+	stmt += renderBody(lines, comments)
+	stmt += "\n);"
+	return stmt
+}
+
+// renderBody junta as linhas do corpo do CREATE com vírgulas, pondo o
+// comentário de cada uma depois da vírgula, no fim da linha.
+func renderBody(lines, comments []string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(line)
+		if i < len(lines)-1 {
+			sb.WriteString(",")
+		}
+		if i < len(comments) {
+			sb.WriteString(sqlComment(comments[i]))
+		}
+	}
+	return sb.String()
+}
+
+func columnDef(c Column) string {
+	def := fmt.Sprintf("  %q %s", c.Name, c.Type)
+	if !c.Nullable {
+		def += " NOT NULL"
+	}
+	if c.Default != "" {
+		def += " DEFAULT " + c.Default
+	}
+	if c.Identity != "" {
+		def += " " + c.Identity
+	}
+	if c.Generated != "" {
+		def += " GENERATED ALWAYS AS (" + c.Generated + ")"
+	}
+	return def
+}
+
+// fkDefinition monta a linha da FK no CREATE TABLE.
+func fkDefinition(fk ForeignKey) string {
+	def := ""
+	if fk.Name != "" {
+		def = "CONSTRAINT " + fk.Name + " "
+	}
+	def += fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s)", strings.Join(fk.Columns, ", "), fk.RefName(), strings.Join(fk.RefColumns, ", "))
+	if fk.OnDelete != "" {
+		def += " ON DELETE " + fk.OnDelete
+	}
+	return def
+}
+
+// compactDefinition tira as linhas em branco e o ponto e vírgula final, que
+// quebrariam a separação dos blocos do schema.
+func compactDefinition(definition string) string {
+	var lines []string
+	for _, line := range strings.Split(definition, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "; ")
+}
+
+// sqlComment formata o comentário como comentário SQL de fim de linha, em
+// uma única linha para não quebrar o DDL.
+func sqlComment(comment string) string {
+	comment = strings.Join(strings.Fields(comment), " ")
+	if comment == "" {
+		return ""
+	}
+	return " -- " + comment
+}
@@ -0,0 +1,103 @@
+package dbschema
+
+import "testing"
+
+func TestRenderTableColumns(t *testing.T) {
+	table := Table{
+		Schema:  "public",
+		Name:    "orders",
+		Kind:    "table",
+		Comment: "pedidos\nde clientes",
+		// a ordem é a da tabela, não a alfabética
+		Columns: []Column{
+			{Name: "id", Type: "bigint", Identity: "GENERATED ALWAYS AS IDENTITY"},
+			{Name: "status", Type: "order_status", Default: "'open'::order_status", Comment: "situação atual"},
+			{Name: "total", Type: "numeric(12,2)", Nullable: true},
+			{Name: "note", Type: "character varying(200)", Nullable: true},
+			{Name: "created_at", Type: "timestamp(3) with time zone", Default: "now()"},
+			{Name: "tags", Type: "text[]", Nullable: true},
+			{Name: "total_cents", Type: "bigint", Nullable: true, Generated: "(total * 100)::bigint"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+
+	want := `CREATE TABLE public.orders ( -- pedidos de clientes
+  "id" bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+  "status" order_status NOT NULL DEFAULT 'open'::order_status, -- situação atual
+  "total" numeric(12,2),
+  "note" character varying(200),
+  "created_at" timestamp(3) with time zone NOT NULL DEFAULT now(),
+  "tags" text[],
+  "total_cents" bigint GENERATED ALWAYS AS ((total * 100)::bigint),
+PRIMARY KEY (id)
+);`
+	if got := RenderTable(table); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderCompositeForeignKey(t *testing.T) {
+	fk := ForeignKey{
+		Name:       "plots_farm_fk",
+		Columns:    []string{"farm_region", "farm_code"},
+		RefSchema:  "public",
+		RefTable:   "farms",
+		RefColumns: []string{"region", "code"},
+		OnDelete:   "CASCADE",
+	}
+	want := "CONSTRAINT plots_farm_fk FOREIGN KEY (farm_region, farm_code) REFERENCES public.farms(region, code) ON DELETE CASCADE"
+	if got := fkDefinition(fk); got != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+
+	// sem nome, como no SQLite
+	fk = ForeignKey{Columns: []string{"a", "b"}, RefTable: "t", RefColumns: []string{"x", "y"}}
+	if got, want := fkDefinition(fk), "FOREIGN KEY (a, b) REFERENCES t(x, y)"; got != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestRenderDDL(t *testing.T) {
+	schema := &Schema{
+		Enums: []Enum{{Schema: "public", Name: "mood", Labels: []string{"ok", "d'oh"}}},
+		Tables: []Table{
+			{
+				Schema:      "public",
+				Name:        "people",
+				Kind:        "table",
+				Columns:     []Column{{Name: "id", Type: "integer", Identity: "GENERATED BY DEFAULT AS IDENTITY"}, {Name: "mood", Type: "mood", Nullable: true}},
+				PrimaryKey:  []string{"id"},
+				Constraints: []Constraint{{Name: "people_mood_check", Definition: "CHECK (mood <> 'd''oh')"}},
+				Indexes:     []Index{{Name: "people_mood_idx", Columns: []string{"mood"}}},
+			},
+			{
+				Schema:     "public",
+				Name:       "happy",
+				Kind:       "view",
+				Comment:    "só os felizes",
+				Columns:    []Column{{Name: "id", Type: "integer", Nullable: true}},
+				Definition: " SELECT id\n\n   FROM people\n  WHERE mood = 'ok'::mood;\n",
+			},
+		},
+	}
+
+	want := `CREATE TYPE public.mood AS ENUM ('ok', 'd''oh');
+
+CREATE TABLE public.people (
+  "id" integer NOT NULL GENERATED BY DEFAULT AS IDENTITY,
+  "mood" mood,
+PRIMARY KEY (id),
+CONSTRAINT people_mood_check CHECK (mood <> 'd''oh'),
+INDEX people_mood_idx (mood)
+);
+
+CREATE VIEW public.happy ( -- só os felizes
+  "id" integer
+) AS
+ SELECT id
+   FROM people
+  WHERE mood = 'ok'::mood;`
+	if got := RenderDDL(schema); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -1,44 +1,184 @@
 package dbschema
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
+	"rag-sql/internal/config"
+	"rag-sql/internal/db"
+	"rag-sql/internal/db/dialect"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 )
 
 type Service struct {
-	db *sql.DB
+	db      db.Querier
+	dialect string
+	intro   introspector
+	policy  config.SchemaPolicy
+	// schemas são os schemas lidos; defaultSchema é o usado para nomes sem
+	// schema
+	schemas         []string
+	defaultSchema   string
+	viewDefinitions bool
+
+	profileMaxValues  int
+	profileSampleRows int
+	profileExclude    []string
+	profileSemantic   []string
+
+	// store guarda o histórico de snapshots; nil quando desligado
+	store *SnapshotStore
+
+	refreshMu sync.Mutex
+	mu        sync.Mutex
+	snapshot  *Snapshot
+	listeners []func(tables []string)
+	// refreshed são chamados a cada releitura, mesmo sem mudança no modelo
+	refreshed []func()
+	// profiles e stats ficam por nome qualificado em minúsculas
+	profiles map[string][]ColumnProfile
+	stats    map[string]TableStats
 }
 
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+// introspector isola as consultas de catálogo de cada dialeto.
+type introspector interface {
+	tables(ctx context.Context, schemas []string) ([]tableRef, error)
+	columns(ctx context.Context, table tableRef) ([]column, error)
+	primaryKey(ctx context.Context, table tableRef) ([]string, error)
+	foreignKeys(ctx context.Context, table tableRef) ([]ForeignKey, error)
 }
 
-func (s *Service) DB() *sql.DB {
-	return s.db
+// As interfaces abaixo são opcionais; dialetos que não as implementam
+// simplesmente não mostram views, tipos enum, constraints, índices ou
+// comentários de tabela.
+type viewLister interface {
+	views(ctx context.Context, schemas []string) ([]tableRef, error)
+	viewDefinition(ctx context.Context, view tableRef) (string, error)
 }
 
-func (s *Service) GetCreateTableStatements() (string, error) {
-	tables, err := s.getTables()
-	if err != nil {
-		return "", err
+// viewDependencyReader informa as tabelas lidas por todas as views do banco,
+// de qualquer schema. Sem ele as dependências das views não são conhecidas.
+type viewDependencyReader interface {
+	viewTables(ctx context.Context) (map[tableRef][]tableRef, error)
+}
+
+type enumLister interface {
+	enums(ctx context.Context, schemas []string) ([]Enum, error)
+}
+
+type constraintLister interface {
+	constraints(ctx context.Context, table tableRef) ([]Constraint, error)
+}
+
+type indexLister interface {
+	indexes(ctx context.Context, table tableRef) ([]Index, error)
+}
+
+type tableCommenter interface {
+	tableComment(ctx context.Context, table tableRef) (string, error)
+}
+
+// tableRef identifica uma tabela ou view. Schema vazio é o banco da conexão
+// no MySQL.
+type tableRef struct {
+	Schema string
+	Name   string
+	Kind   relationKind
+}
+
+type relationKind string
+
+const (
+	kindTable            relationKind = ""
+	kindView             relationKind = "VIEW"
+	kindMaterializedView relationKind = "MATERIALIZED VIEW"
+)
+
+// String devolve o nome qualificado usado no CREATE TABLE, no grafo e nas
+// notificações de mudança.
+func (t tableRef) String() string {
+	if t.Schema == "" {
+		return t.Name
 	}
+	return t.Schema + "." + t.Name
+}
 
-	var output []string
-	for _, table := range tables {
-		createStmt, err := s.buildCreateTable(table)
-		if err != nil {
-			return "", err
-		}
-		output = append(output, createStmt)
+// parseTableRef lê "schema.tabela" ou só "tabela", que fica no schema padrão.
+func parseTableRef(name, defaultSchema string) tableRef {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return tableRef{Schema: schema, Name: table}
+	}
+	return tableRef{Schema: defaultSchema, Name: name}
+}
+
+type column struct {
+	Name     string
+	DataType string
+	Nullable bool
+	Comment  string
+	// Default é a expressão do DEFAULT; Identity é a cláusula de geração
+	// automática do dialeto ("GENERATED ALWAYS AS IDENTITY",
+	// "AUTO_INCREMENT"); Generated é a expressão de colunas calculadas.
+	Default   string
+	Identity  string
+	Generated string
+}
+
+// NewService cria o serviço para os schemas de cfg; sem nenhum, usa o schema
+// padrão do dialeto.
+func NewService(db db.Querier, dialectName string, cfg config.SchemaConfig, policy config.SchemaPolicy) *Service {
+	var intro introspector
+	switch dialectName {
+	case dialect.SQLite:
+		intro = &sqliteIntrospector{db: db}
+	case dialect.MySQL:
+		intro = &mysqlIntrospector{db: db}
+	default:
+		intro = &postgresIntrospector{db: db}
+	}
+	defaultSchema := dialect.DefaultSchema(dialectName)
+	schemas := cfg.Schemas
+	if len(schemas) == 0 && defaultSchema != "" {
+		schemas = []string{defaultSchema}
+	}
+	var store *SnapshotStore
+	if cfg.SnapshotDir != "" {
+		store = NewSnapshotStore(cfg.SnapshotDir)
 	}
+	return &Service{
+		db:                db,
+		dialect:           dialectName,
+		intro:             intro,
+		policy:            policy,
+		schemas:           schemas,
+		defaultSchema:     defaultSchema,
+		viewDefinitions:   cfg.ViewDefinitions,
+		profileMaxValues:  cfg.ProfileMaxValues,
+		profileSampleRows: cfg.ProfileSampleRows,
+		profileExclude:    cfg.ProfileExclude,
+		profileSemantic:   cfg.ProfileExcludeSemantic,
+		store:             store,
+	}
+}
+
+func (s *Service) DB() db.Querier {
+	return s.db
+}
 
-	return strings.Join(output, "\n\n"), nil
+// GetCreateTableStatements descreve os tipos enum, as tabelas e as views
+// como DDL (ver RenderDDL).
+func (s *Service) GetCreateTableStatements(ctx context.Context) (string, error) {
+	schema, err := s.Schema(ctx)
+	if err != nil {
+		return "", err
+	}
+	return RenderDDL(schema), nil
 }
 
-func (s *Service) GetAllAsString() (string, error) {
-	createStatements, err := s.GetCreateTableStatements()
+func (s *Service) GetAllAsString(ctx context.Context) (string, error) {
+	createStatements, err := s.GetCreateTableStatements(ctx)
 	if err != nil {
 		return "", fmt.Errorf("erro ao obter declarações de criação: %w", err)
 	}
@@ -48,19 +188,18 @@ func (s *Service) GetAllAsString() (string, error) {
 	return createStatements, nil
 }
 
-func (s *Service) ExtractTableNames() []string {
-	re := regexp.MustCompile(`(?i)create table "?(\w+)"?`)
-	allStr, err := s.GetAllAsString()
+// ExtractTableNames devolve os nomes qualificados das tabelas e views
+// visíveis, em minúsculas.
+func (s *Service) ExtractTableNames(ctx context.Context) []string {
+	tables, err := s.getTables(ctx)
 	if err != nil {
 		return nil
 	}
 
-	matches := re.FindAllStringSubmatch(allStr, -1)
-
 	var names []string
 	seen := map[string]bool{}
-	for _, m := range matches {
-		name := strings.ToLower(m[1])
+	for _, t := range tables {
+		name := strings.ToLower(t.String())
 		if !seen[name] {
 			names = append(names, name)
 			seen[name] = true
@@ -69,146 +208,153 @@ func (s *Service) ExtractTableNames() []string {
 	return names
 }
 
-func (s *Service) GetColumnsTable(table string) ([]string, error) {
-	columns, err := s.getColumns(table)
+// GetColumnsTable aceita o nome qualificado ou só o da tabela, que é
+// procurada no schema padrão.
+func (s *Service) GetColumnsTable(ctx context.Context, table string) ([]string, error) {
+	columns, err := s.getColumns(ctx, parseTableRef(table, s.defaultSchema))
 	if err != nil {
 		return nil, err
 	}
 	return columns, nil
 }
 
-func (s *Service) getTables() ([]string, error) {
-	rows, err := s.db.Query(`
-		SELECT table_name
-		FROM information_schema.tables
-		WHERE table_schema = 'public' AND table_type = 'BASE TABLE'
-	`)
+// getTables lista as tabelas e, quando o dialeto sabe, as views visíveis.
+func (s *Service) getTables(ctx context.Context) ([]tableRef, error) {
+	refs, err := s.intro.tables(ctx, s.schemas)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var tables []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+	if vl, ok := s.intro.(viewLister); ok {
+		views, err := vl.views(ctx, s.schemas)
+		if err != nil {
 			return nil, err
 		}
-		tables = append(tables, name)
+		refs = append(refs, views...)
+	}
+
+	var tables []tableRef
+	for _, t := range refs {
+		if !s.policy.TableVisible(t.Schema, t.Name) {
+			continue
+		}
+		tables = append(tables, t)
 	}
 	return tables, nil
 }
 
-func (s *Service) buildCreateTable(table string) (string, error) {
-	columns, err := s.getColumns(table)
+func (s *Service) getColumns(ctx context.Context, table tableRef) ([]string, error) {
+	columns, err := s.visibleColumns(ctx, table)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	pk, err := s.getPrimaryKey(table)
-	if err != nil {
-		return "", err
+	var cols []string
+	for _, c := range columns {
+		cols = append(cols, columnDef(c)+sqlComment(c.Comment))
 	}
+	return cols, nil
+}
 
-	fks, err := s.getForeignKeys(table)
+func (s *Service) visibleColumns(ctx context.Context, table tableRef) ([]Column, error) {
+	columns, err := s.intro.columns(ctx, table)
 	if err != nil {
-		return "", err
-	}
-
-	stmt := fmt.Sprintf("CREATE TABLE %s (\n", table)
-	stmt += strings.Join(columns, ",\n")
-
-	if pk != "" {
-		stmt += fmt.Sprintf(",\nPRIMARY KEY (%s)", pk)
+		return nil, err
 	}
 
-	for _, fk := range fks {
-		stmt += fmt.Sprintf(",\nFOREIGN KEY (%s) REFERENCES %s(%s)", fk.Column, fk.RefTable, fk.RefColumn)
+	var cols []Column
+	for _, c := range columns {
+		if !s.policy.ColumnVisible(table.Schema, table.Name, c.Name) {
+			continue
+		}
+		cols = append(cols, Column{
+			Name:      c.Name,
+			Type:      c.DataType,
+			Nullable:  c.Nullable,
+			Comment:   c.Comment,
+			Default:   c.Default,
+			Identity:  c.Identity,
+			Generated: c.Generated,
+		})
 	}
-
-	stmt += "\n);"
-	return stmt, nil
+	return cols, nil
 }
 
-func (s *Service) getColumns(table string) ([]string, error) {
-	rows, err := s.db.Query(`
-		SELECT column_name, data_type, is_nullable
-		FROM information_schema.columns
-		WHERE table_name = $1
-	`, table)
+func (s *Service) getPrimaryKey(ctx context.Context, table tableRef) ([]string, error) {
+	pk, err := s.intro.primaryKey(ctx, table)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var cols []string
-	for rows.Next() {
-		var name, dataType, nullable string
-		if err := rows.Scan(&name, &dataType, &nullable); err != nil {
-			return nil, err
-		}
-		nullStr := ""
-		if nullable == "NO" {
-			nullStr = " NOT NULL"
+	var visible []string
+	for _, col := range pk {
+		if s.policy.ColumnVisible(table.Schema, table.Name, col) {
+			visible = append(visible, col)
 		}
-		cols = append(cols, fmt.Sprintf("  %q %s%s", name, dataType, nullStr))
 	}
-	return cols, nil
-}
 
-func (s *Service) getPrimaryKey(table string) (string, error) {
-	var pk sql.NullString
-	err := s.db.QueryRow(`
-	SELECT string_agg(a.attname, ', ')
-	FROM pg_index i
-	JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
-	WHERE i.indrelid = $1::regclass AND i.indisprimary
-`, table).Scan(&pk)
+	return visible, nil
+}
 
+func (s *Service) getForeignKeys(ctx context.Context, table tableRef) ([]ForeignKey, error) {
+	fks, err := s.intro.foreignKeys(ctx, table)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if !pk.Valid {
-		return "", nil
+	var visible []ForeignKey
+	for _, fk := range fks {
+		ref := tableRef{Schema: fk.RefSchema, Name: fk.RefTable}
+		if !s.columnsVisible(table, fk.Columns) || !s.columnsVisible(ref, fk.RefColumns) {
+			continue
+		}
+		visible = append(visible, fk)
 	}
-
-	return pk.String, nil
-
+	return visible, nil
 }
 
-type foreignKey struct {
-	Column    string
-	RefTable  string
-	RefColumn string
+// onDeleteAction normaliza a regra de ON DELETE; NO ACTION, o padrão, vira
+// vazio.
+func onDeleteAction(rule string) string {
+	rule = strings.ToUpper(strings.TrimSpace(rule))
+	if rule == "NO ACTION" {
+		return ""
+	}
+	return rule
 }
 
-func (s *Service) getForeignKeys(table string) ([]foreignKey, error) {
-	rows, err := s.db.Query(`
-		SELECT
-			kcu.column_name,
-			ccu.table_name AS foreign_table_name,
-			ccu.column_name AS foreign_column_name
-		FROM 
-			information_schema.table_constraints AS tc 
-			JOIN information_schema.key_column_usage AS kcu
-			  ON tc.constraint_name = kcu.constraint_name
-			JOIN information_schema.constraint_column_usage AS ccu
-			  ON ccu.constraint_name = tc.constraint_name
-		WHERE constraint_type = 'FOREIGN KEY' AND tc.table_name=$1;
-	`, table)
+func (s *Service) getIndexes(ctx context.Context, table tableRef) ([]Index, error) {
+	il, ok := s.intro.(indexLister)
+	if !ok {
+		return nil, nil
+	}
+
+	indexes, err := il.indexes(ctx, table)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var fks []foreignKey
-	for rows.Next() {
-		var fk foreignKey
-		if err := rows.Scan(&fk.Column, &fk.RefTable, &fk.RefColumn); err != nil {
-			return nil, err
+	// índices que envolvem colunas ocultas revelariam a existência delas
+	var visible []Index
+	for _, idx := range indexes {
+		if !s.columnsVisible(table, idx.Columns) {
+			continue
 		}
-		fks = append(fks, fk)
+		visible = append(visible, idx)
 	}
-	return fks, nil
+	return visible, nil
 }
+
+// columnsVisible indica se as colunas podem aparecer no schema. Expressões
+// no lugar de colunas só aparecem quando nenhuma coluna da tabela é oculta,
+// já que não dá para saber quais colunas elas usam.
+func (s *Service) columnsVisible(table tableRef, columns []string) bool {
+	restricted := s.policy.HasColumnRestrictions(table.Schema, table.Name)
+	return !slices.ContainsFunc(columns, func(col string) bool {
+		if !identifierRe.MatchString(col) {
+			return restricted
+		}
+		return !s.policy.ColumnVisible(table.Schema, table.Name, col)
+	})
+}
+
+var identifierRe = regexp.MustCompile(`^\w+$`)
@@ -0,0 +1,211 @@
+package dbschema
+
+import (
+	"context"
+	"database/sql"
+	"rag-sql/internal/db"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// sqliteIntrospector trata como schemas o banco principal ("main") e os
+// bancos anexados com ATTACH.
+type sqliteIntrospector struct {
+	db db.Querier
+}
+
+func (l *sqliteIntrospector) tables(ctx context.Context, schemas []string) ([]tableRef, error) {
+	return l.relations(ctx, schemas, "table", kindTable)
+}
+
+func (l *sqliteIntrospector) views(ctx context.Context, schemas []string) ([]tableRef, error) {
+	return l.relations(ctx, schemas, "view", kindView)
+}
+
+func (l *sqliteIntrospector) relations(ctx context.Context, schemas []string, objectType string, kind relationKind) ([]tableRef, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT schema, name
+		FROM pragma_table_list
+		WHERE type = ? AND name NOT LIKE 'sqlite_%'
+		ORDER BY schema, name
+	`, objectType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []tableRef
+	for rows.Next() {
+		t := tableRef{Kind: kind}
+		if err := rows.Scan(&t.Schema, &t.Name); err != nil {
+			return nil, err
+		}
+		if slices.Contains(schemas, t.Schema) {
+			tables = append(tables, t)
+		}
+	}
+	return tables, rows.Err()
+}
+
+// viewDefinition tira o "CREATE VIEW ... AS" do SQL guardado pelo SQLite.
+func (l *sqliteIntrospector) viewDefinition(ctx context.Context, view tableRef) (string, error) {
+	master := `"` + strings.ReplaceAll(view.Schema, `"`, `""`) + `".sqlite_master`
+	var definition string
+	err := l.db.QueryRowContext(ctx, `SELECT sql FROM `+master+` WHERE type = 'view' AND name = ?`, view.Name).Scan(&definition)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if loc := viewPrefixRe.FindStringIndex(definition); loc != nil {
+		definition = definition[loc[1]:]
+	}
+	return strings.TrimSpace(definition), nil
+}
+
+var viewPrefixRe = regexp.MustCompile(`(?is)^\s*create\s+(?:temp\w*\s+)?view\s.*?\sas\s`)
+
+// indexes inclui os índices criados pelas constraints UNIQUE, que o SQLite
+// não lista de outra forma. Colunas de índices por expressão aparecem como
+// "(expressão)".
+func (l *sqliteIntrospector) indexes(ctx context.Context, table tableRef) ([]Index, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT il.name, il."unique", COALESCE(ii.name, '(expressão)')
+		FROM pragma_index_list(?, ?) AS il
+		JOIN pragma_index_info(il.name, ?) AS ii
+		WHERE il.origin <> 'pk'
+		ORDER BY il.name, ii.seqno
+	`, table.Name, table.Schema, table.Schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []Index
+	for rows.Next() {
+		var name, col string
+		var unique int
+		if err := rows.Scan(&name, &unique, &col); err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, col)
+			continue
+		}
+		indexes = append(indexes, Index{Name: name, Columns: []string{col}, Unique: unique == 1})
+	}
+	return indexes, rows.Err()
+}
+
+// columns usa o table_xinfo, que inclui as colunas geradas (hidden 2 e 3);
+// as ocultas de tabelas virtuais (hidden 1) ficam de fora. O SQLite não
+// expõe a expressão das colunas geradas.
+func (l *sqliteIntrospector) columns(ctx context.Context, table tableRef) ([]column, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT name, type, "notnull", pk, COALESCE(dflt_value, '')
+		FROM pragma_table_xinfo(?, ?)
+		WHERE hidden <> 1
+		ORDER BY cid
+	`, table.Name, table.Schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []column
+	for rows.Next() {
+		var c column
+		var notNull, pk int
+		if err := rows.Scan(&c.Name, &c.DataType, &notNull, &pk, &c.Default); err != nil {
+			return nil, err
+		}
+		if c.DataType == "" {
+			// colunas sem tipo declarado têm afinidade BLOB no SQLite
+			c.DataType = "BLOB"
+		}
+		c.Nullable = notNull == 0 && pk == 0
+		cols = append(cols, c)
+	}
+	return cols, rows.Err()
+}
+
+func (l *sqliteIntrospector) primaryKey(ctx context.Context, table tableRef) ([]string, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT name
+		FROM pragma_table_info(?, ?)
+		WHERE pk > 0
+		ORDER BY pk
+	`, table.Name, table.Schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pk []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		pk = append(pk, name)
+	}
+	return pk, rows.Err()
+}
+
+// foreignKeys agrupa as linhas do pragma pelo id da FK. O SQLite não guarda
+// nome para as FKs.
+func (l *sqliteIntrospector) foreignKeys(ctx context.Context, table tableRef) ([]ForeignKey, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT id, "from", "table", COALESCE("to", ''), on_delete
+		FROM pragma_foreign_key_list(?, ?)
+		ORDER BY id, seq
+	`, table.Name, table.Schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []ForeignKey
+	var ids []int
+	for rows.Next() {
+		var id int
+		var col, refTable, refCol, onDelete string
+		if err := rows.Scan(&id, &col, &refTable, &refCol, &onDelete); err != nil {
+			return nil, err
+		}
+		if n := len(fks); n > 0 && ids[n-1] == id {
+			fks[n-1].Columns = append(fks[n-1].Columns, col)
+			fks[n-1].RefColumns = append(fks[n-1].RefColumns, refCol)
+			continue
+		}
+		// no SQLite a FK só pode apontar para o mesmo banco
+		fks = append(fks, ForeignKey{
+			Columns:    []string{col},
+			RefSchema:  table.Schema,
+			RefTable:   refTable,
+			RefColumns: []string{refCol},
+			OnDelete:   onDeleteAction(onDelete),
+		})
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// sem colunas explícitas, a FK aponta para a chave primária da tabela referenciada
+	for i, fk := range fks {
+		if fk.RefColumns[0] != "" {
+			continue
+		}
+		pk, err := l.primaryKey(ctx, tableRef{Schema: fk.RefSchema, Name: fk.RefTable})
+		if err != nil {
+			return nil, err
+		}
+		if len(pk) == len(fk.Columns) {
+			fks[i].RefColumns = pk
+		}
+	}
+	return fks, nil
+}
@@ -0,0 +1,98 @@
+package dbschema
+
+import (
+	"context"
+	"database/sql"
+	"rag-sql/internal/config"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func openSQLite(t *testing.T, ddl ...string) *sql.DB {
+	t.Helper()
+	conn, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cada conexão teria o seu próprio banco em memória
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	for _, stmt := range ddl {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn
+}
+
+func TestSQLiteCompositeForeignKeys(t *testing.T) {
+	conn := openSQLite(t,
+		`CREATE TABLE farms (region TEXT, code INTEGER, name TEXT, PRIMARY KEY (region, code))`,
+		`CREATE TABLE plots (
+			id INTEGER PRIMARY KEY,
+			farm_code INTEGER,
+			farm_region TEXT,
+			origin_region TEXT,
+			origin_code INTEGER,
+			FOREIGN KEY (farm_region, farm_code) REFERENCES farms (region, code) ON DELETE CASCADE,
+			FOREIGN KEY (origin_code, origin_region) REFERENCES farms (code, region),
+			FOREIGN KEY (origin_region, origin_code) REFERENCES farms
+		)`,
+	)
+	intro := &sqliteIntrospector{db: conn}
+
+	fks, err := intro.foreignKeys(context.Background(), tableRef{Schema: "main", Name: "plots"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cada coluna continua pareada com a que referencia, na ordem da
+	// constraint; sem colunas explícitas vale a PK da tabela referenciada
+	want := []ForeignKey{
+		{Columns: []string{"origin_region", "origin_code"}, RefSchema: "main", RefTable: "farms", RefColumns: []string{"region", "code"}},
+		{Columns: []string{"origin_code", "origin_region"}, RefSchema: "main", RefTable: "farms", RefColumns: []string{"code", "region"}},
+		{Columns: []string{"farm_region", "farm_code"}, RefSchema: "main", RefTable: "farms", RefColumns: []string{"region", "code"}, OnDelete: "CASCADE"},
+	}
+	if !reflect.DeepEqual(fks, want) {
+		t.Fatalf("got %+v\nwant %+v", fks, want)
+	}
+}
+
+func TestSQLiteSchemaDDL(t *testing.T) {
+	conn := openSQLite(t,
+		`CREATE TABLE farms (
+			name VARCHAR(80) NOT NULL,
+			id INTEGER PRIMARY KEY,
+			area NUMERIC(10, 2) DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE VIEW big_farms AS SELECT id, name FROM farms WHERE area > 1000;`,
+	)
+	s := NewService(conn, "sqlite", config.SchemaConfig{ViewDefinitions: true}, config.SchemaPolicy{})
+
+	schema, err := s.Schema(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// colunas na ordem da tabela, com o tipo como foi declarado
+	want := `CREATE TABLE main.farms (
+  "name" VARCHAR(80) NOT NULL,
+  "id" INTEGER NOT NULL,
+  "area" NUMERIC(10, 2) DEFAULT 0,
+  "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (id)
+);
+
+CREATE VIEW main.big_farms (
+  "id" INTEGER,
+  "name" VARCHAR(80)
+) AS
+SELECT id, name FROM farms WHERE area > 1000;`
+	if got := RenderDDL(schema); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,91 @@
+package dbschema
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// TableStats são as estimativas do planejador para uma tabela, lidas sem
+// percorrer os dados.
+type TableStats struct {
+	EstimatedRows float64       `json:"estimated_rows"`
+	Columns       []ColumnStats `json:"columns,omitempty"`
+}
+
+// ColumnStats resume as estatísticas de uma coluna. Distinct é a estimativa
+// de valores distintos; CommonValues são os mais frequentes e Min e Max os
+// extremos do histograma.
+type ColumnStats struct {
+	Column       string   `json:"column"`
+	Distinct     float64  `json:"distinct"`
+	NullFraction float64  `json:"null_fraction"`
+	CommonValues []string `json:"common_values,omitempty"`
+	Min          string   `json:"min,omitempty"`
+	Max          string   `json:"max,omitempty"`
+}
+
+// statsReader é implementado pelos dialetos que guardam estatísticas de
+// colunas no catálogo. Tabelas nunca analisadas vêm sem colunas.
+type statsReader interface {
+	tableStats(ctx context.Context, table tableRef) (TableStats, error)
+}
+
+// TableStats devolve as estatísticas da tabela, pelo nome qualificado ou só
+// pelo nome no schema padrão, como lidas na última coleta de perfis.
+func (s *Service) TableStats(table string) (TableStats, bool) {
+	key := strings.ToLower(parseTableRef(table, s.defaultSchema).String())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats, ok := s.stats[key]
+	return stats, ok
+}
+
+// readStats lê as estatísticas das colunas visíveis. Os valores das colunas
+// excluídas dos perfis são descartados; as estimativas ficam.
+func (s *Service) readStats(ctx context.Context, table tableRef) (TableStats, bool, error) {
+	sr, ok := s.intro.(statsReader)
+	if !ok {
+		return TableStats{}, false, nil
+	}
+
+	stats, err := sr.tableStats(ctx, table)
+	if err != nil {
+		return TableStats{}, false, err
+	}
+
+	columns := stats.Columns[:0]
+	for _, c := range stats.Columns {
+		if !s.policy.ColumnVisible(table.Schema, table.Name, c.Column) {
+			continue
+		}
+		if s.profileExcluded(table, "") || s.profileExcluded(table, c.Column) || s.profileMasked(c.Column, c.values()...) {
+			c.CommonValues, c.Min, c.Max = nil, "", ""
+		}
+		columns = append(columns, c)
+	}
+	stats.Columns = columns
+	return stats, true, nil
+}
+
+// values junta os valores frequentes e os extremos, que também vão para o
+// prompt.
+func (c ColumnStats) values() []string {
+	values := slices.Clone(c.CommonValues)
+	for _, v := range []string{c.Min, c.Max} {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (t TableStats) column(name string) (ColumnStats, bool) {
+	for _, c := range t.Columns {
+		if c.Column == name {
+			return c, true
+		}
+	}
+	return ColumnStats{}, false
+}
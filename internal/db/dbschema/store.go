@@ -0,0 +1,158 @@
+package dbschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotStore guarda os snapshots em arquivos JSON num diretório, um por
+// versão do schema. O nome do arquivo é o ID: o horário da leitura em UTC e
+// o começo do hash ("20240501T120000Z-1a2b3c4d5e6f").
+type SnapshotStore struct {
+	dir string
+}
+
+// SnapshotInfo identifica um snapshot guardado. Hash é só o começo do hash
+// do snapshot, o que vai no ID.
+type SnapshotInfo struct {
+	ID       string    `json:"id"`
+	Hash     string    `json:"hash"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// ErrSnapshotNotFound é devolvido quando a referência não casa com nenhum
+// snapshot guardado.
+var ErrSnapshotNotFound = errors.New("snapshot não encontrado")
+
+const (
+	snapshotTimeFormat = "20060102T150405Z"
+	snapshotHashPrefix = 12
+)
+
+func NewSnapshotStore(dir string) *SnapshotStore {
+	return &SnapshotStore{dir: dir}
+}
+
+// ID é o nome com que o snapshot é guardado.
+func (snap *Snapshot) ID() string {
+	return snap.LoadedAt.UTC().Format(snapshotTimeFormat) + "-" + snap.Hash[:snapshotHashPrefix]
+}
+
+// Save guarda o snapshot, a menos que o mais recente já tenha o mesmo hash.
+func (st *SnapshotStore) Save(snap *Snapshot) error {
+	infos, err := st.List()
+	if err != nil {
+		return err
+	}
+	if n := len(infos); n > 0 && infos[n-1].Hash == snap.Hash[:snapshotHashPrefix] {
+		return nil
+	}
+
+	if err := os.MkdirAll(st.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	id := snap.ID()
+	// grava num temporário e renomeia, para não deixar um arquivo pela
+	// metade se o processo cair
+	tmp := filepath.Join(st.dir, "."+id+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(st.dir, id+".json"))
+}
+
+// List devolve os snapshots guardados, do mais antigo ao mais recente.
+func (st *SnapshotStore) List() ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(st.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []SnapshotInfo
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		stamp, hash, ok := strings.Cut(id, "-")
+		if !ok {
+			continue
+		}
+		loadedAt, err := time.Parse(snapshotTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, SnapshotInfo{ID: id, Hash: hash, LoadedAt: loadedAt})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+// Load lê o snapshot pela referência: "latest", "previous", um horário
+// RFC 3339 (o snapshot em vigor naquele momento) ou o ID.
+func (st *SnapshotStore) Load(ref string) (*Snapshot, error) {
+	infos, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := resolveSnapshot(infos, ref)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, ref)
+	}
+
+	data, err := os.ReadFile(filepath.Join(st.dir, info.ID+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("%s: %w", info.ID, err)
+	}
+	return &snap, nil
+}
+
+func resolveSnapshot(infos []SnapshotInfo, ref string) (SnapshotInfo, bool) {
+	n := len(infos)
+	switch ref {
+	case "", "latest":
+		if n > 0 {
+			return infos[n-1], true
+		}
+		return SnapshotInfo{}, false
+	case "previous":
+		if n > 1 {
+			return infos[n-2], true
+		}
+		return SnapshotInfo{}, false
+	}
+
+	if at, err := time.Parse(time.RFC3339, ref); err == nil {
+		i := sort.Search(n, func(i int) bool { return infos[i].LoadedAt.After(at) })
+		if i == 0 {
+			return SnapshotInfo{}, false
+		}
+		return infos[i-1], true
+	}
+
+	for _, info := range infos {
+		if info.ID == ref {
+			return info, true
+		}
+	}
+	return SnapshotInfo{}, false
+}
@@ -0,0 +1,108 @@
+package dbschema
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func testSnapshot(hash string, at time.Time) *Snapshot {
+	return &Snapshot{
+		Schema:   &Schema{Tables: []Table{{Schema: "public", Name: "orders", Kind: "table"}}},
+		Hash:     hash,
+		LoadedAt: at,
+	}
+}
+
+func TestSnapshotStoreSkipsUnchangedSchema(t *testing.T) {
+	st := NewSnapshotStore(t.TempDir())
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	hashA := "1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b"
+	hashB := "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100"
+
+	// a mesma leitura duas vezes, depois uma mudança e a volta ao original
+	for i, hash := range []string{hashA, hashA, hashB, hashA} {
+		if err := st.Save(testSnapshot(hash, t0.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := st.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20240501T120000Z-1a2b3c4d5e6f", "20240501T120200Z-ffeeddccbbaa", "20240501T120300Z-1a2b3c4d5e6f"}
+	if len(infos) != len(want) {
+		t.Fatalf("%d snapshots guardados (%+v), want %d", len(infos), infos, len(want))
+	}
+	for i, id := range want {
+		if infos[i].ID != id {
+			t.Fatalf("snapshot %d = %s, want %s", i, infos[i].ID, id)
+		}
+	}
+	if !infos[0].LoadedAt.Equal(t0) || infos[0].Hash != hashA[:12] {
+		t.Fatalf("info = %+v", infos[0])
+	}
+}
+
+func TestSnapshotStoreLoad(t *testing.T) {
+	dir := t.TempDir()
+	st := NewSnapshotStore(dir)
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	first := testSnapshot("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", t0)
+	second := testSnapshot("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", t0.Add(time.Hour))
+	for _, snap := range []*Snapshot{first, second} {
+		if err := st.Save(snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// arquivos que não são snapshots ficam de fora
+	if err := os.WriteFile(dir+"/notas.json", []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref  string
+		want *Snapshot
+	}{
+		{"", second},
+		{"latest", second},
+		{"previous", first},
+		{first.ID(), first},
+		{"2024-05-01T12:30:00Z", first},
+		{"2024-05-01T09:30:00-03:00", first},
+		{"2024-05-01T13:00:00Z", second},
+		{"2024-05-01T11:59:59Z", nil},
+		{"20240501T120000Z-ffffffffffff", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := st.Load(tt.ref)
+		if tt.want == nil {
+			if !errors.Is(err, ErrSnapshotNotFound) {
+				t.Errorf("Load(%q) err = %v, want ErrSnapshotNotFound", tt.ref, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Load(%q): %v", tt.ref, err)
+			continue
+		}
+		// o hash completo volta do arquivo
+		if got.Hash != tt.want.Hash || !got.LoadedAt.Equal(tt.want.LoadedAt) || len(got.Schema.Tables) != 1 {
+			t.Errorf("Load(%q) = %s, want %s", tt.ref, got.ID(), tt.want.ID())
+		}
+	}
+}
+
+func TestSnapshotStoreEmpty(t *testing.T) {
+	st := NewSnapshotStore(t.TempDir() + "/nao-existe")
+	infos, err := st.List()
+	if err != nil || infos != nil {
+		t.Fatalf("List = %v, %v; want vazio", infos, err)
+	}
+	if _, err := st.Load("latest"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Fatalf("Load err = %v, want ErrSnapshotNotFound", err)
+	}
+}
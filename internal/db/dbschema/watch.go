@@ -0,0 +1,181 @@
+package dbschema
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OnChange registra uma função chamada com os nomes qualificados das tabelas
+// criadas, removidas ou alteradas desde a última verificação, já com o
+// snapshot novo em Schema. Deve ser chamado antes de Watch e de ListenDDL.
+func (s *Service) OnChange(fn func(tables []string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// OnRefresh registra uma função chamada a cada releitura do schema, mesmo
+// quando o modelo não mudou: há mudanças, como a consulta de uma view com as
+// mesmas colunas, que o modelo não mostra. Deve ser chamado antes de Watch e
+// de ListenDDL.
+func (s *Service) OnRefresh(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshed = append(s.refreshed, fn)
+}
+
+// Watch atualiza o snapshot a cada intervalo até o contexto ser cancelado,
+// avisando os interessados quando alguma tabela muda.
+func (s *Service) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.DetectChanges(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("erro ao verificar mudanças no schema: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ddlDebounce é o tempo sem novos avisos de DDL antes de reler o schema; uma
+// migração costuma gerar vários avisos seguidos.
+const ddlDebounce = 2 * time.Second
+
+// ListenDDL atualiza o snapshot quando o Postgres avisa de DDL no canal,
+// o que exige o event trigger de EventTriggerSQL. Só volta com o contexto
+// cancelado ou se não conseguir escutar o canal.
+func (s *Service) ListenDDL(ctx context.Context, connString, channel string) error {
+	listener := pq.NewListener(connString, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("erro na escuta de DDL: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(channel); err != nil {
+		return fmt.Errorf("erro ao escutar o canal %s: %w", channel, err)
+	}
+
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+
+	var refresh <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-listener.Notify:
+			// um aviso nil indica reconexão, e avisos podem ter se perdido;
+			// nos dois casos o schema é relido
+			refresh = time.After(ddlDebounce)
+		case <-refresh:
+			refresh = nil
+			if err := s.DetectChanges(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("erro ao verificar mudanças no schema: %v", err)
+			}
+		case <-ping.C:
+			// detecta conexões mortas, que não dariam erro até o próximo aviso
+			if err := listener.Ping(); err != nil {
+				log.Printf("erro na escuta de DDL: %v", err)
+			}
+		}
+	}
+}
+
+// EventTriggerSQL cria o event trigger que avisa no canal a cada comando de
+// DDL, inclusive DROP e COMMENT. Criar event triggers exige superusuário.
+func EventTriggerSQL(channel string) string {
+	return fmt.Sprintf(`
+CREATE OR REPLACE FUNCTION rag_sql_notify_ddl() RETURNS event_trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+	PERFORM pg_notify(%s, tg_tag);
+END
+$$;
+DROP EVENT TRIGGER IF EXISTS rag_sql_ddl;
+CREATE EVENT TRIGGER rag_sql_ddl ON ddl_command_end EXECUTE PROCEDURE rag_sql_notify_ddl();
+`, pq.QuoteLiteral(channel))
+}
+
+// DetectChanges relê o schema, troca o snapshot e, se o conteúdo mudou,
+// avisa os interessados sobre as tabelas alteradas. As verificações de Watch
+// e de ListenDDL não rodam ao mesmo tempo.
+func (s *Service) DetectChanges(ctx context.Context) error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	snap, err := s.loadSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	previous := s.snapshot
+	s.snapshot = snap
+	listeners, refreshed := s.listeners, s.refreshed
+	s.mu.Unlock()
+
+	for _, fn := range refreshed {
+		fn()
+	}
+
+	if previous == nil || previous.Hash == snap.Hash {
+		// a primeira leitura também entra no histórico
+		if previous == nil {
+			s.saveSnapshot(snap)
+		}
+		return nil
+	}
+	s.saveSnapshot(snap)
+
+	changed := changedTables(previous.Schema, snap.Schema)
+	if len(changed) == 0 {
+		return nil
+	}
+	log.Printf("schema alterado nas tabelas: %v", changed)
+	for _, fn := range listeners {
+		fn(changed)
+	}
+	return nil
+}
+
+// changedTables compara as definições das tabelas dos dois modelos.
+func changedTables(previous, current *Schema) []string {
+	defs := func(schema *Schema) map[string]string {
+		m := make(map[string]string, len(schema.Tables))
+		for _, t := range schema.Tables {
+			m[t.QualifiedName()] = RenderTable(t)
+		}
+		return m
+	}
+	before, after := defs(previous), defs(current)
+
+	var changed []string
+	for table, def := range after {
+		if before[table] != def {
+			changed = append(changed, table)
+		}
+	}
+	for table := range before {
+		if _, ok := after[table]; !ok {
+			changed = append(changed, table)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
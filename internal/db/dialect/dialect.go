@@ -0,0 +1,91 @@
+package dialect
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+	MySQL    = "mysql"
+)
+
+func Validate(name string) error {
+	switch name {
+	case Postgres, SQLite, MySQL:
+		return nil
+	default:
+		return fmt.Errorf("dialeto não suportado: %q", name)
+	}
+}
+
+// DriverName devolve o nome do driver database/sql do dialeto.
+func DriverName(name string) string {
+	switch name {
+	case SQLite:
+		return "sqlite"
+	case MySQL:
+		return "mysql"
+	default:
+		return "postgres"
+	}
+}
+
+// DefaultPort devolve a porta padrão do servidor do dialeto.
+func DefaultPort(name string) string {
+	switch name {
+	case MySQL:
+		return "3306"
+	default:
+		return "5432"
+	}
+}
+
+// DefaultSchema é o schema assumido quando a consulta não qualifica a tabela.
+func DefaultSchema(name string) string {
+	switch name {
+	case SQLite:
+		return "main"
+	case MySQL:
+		// no MySQL o schema é o próprio banco; tabelas sem qualificação
+		// ficam sem schema e a política casa só pelo nome
+		return ""
+	default:
+		return "public"
+	}
+}
+
+// PromptHints orienta o modelo a escrever SQL no dialeto do banco.
+func PromptHints(name string) []string {
+	switch name {
+	case SQLite:
+		return []string{
+			"O banco é SQLite. Gere SQL compatível com SQLite.",
+			"Não use ILIKE, ::tipo, DATE_TRUNC, EXTRACT nem funções específicas do Postgres.",
+			"Para datas use date(), datetime() e strftime(); para texto sem diferenciar maiúsculas use LOWER(coluna) LIKE LOWER('...').",
+			"Use CAST(coluna AS REAL) ou CAST(coluna AS INTEGER) para conversões numéricas.",
+		}
+	case MySQL:
+		return []string{
+			"O banco é MySQL/MariaDB. Gere SQL compatível com MySQL.",
+			"Não use ILIKE, ::tipo, DATE_TRUNC, FULL JOIN nem funções específicas do Postgres.",
+			"Use LIMIT n OFFSET m (nunca LIMIT m, n) e crases ou nenhum delimitador para identificadores.",
+			"Para datas use DATE(), DATE_FORMAT() e intervalos com o número entre aspas, como NOW() - INTERVAL '7' DAY ou DATE_SUB(CURDATE(), INTERVAL '1' MONTH); para texto use LIKE, que já ignora maiúsculas na maioria das collations.",
+			"Em strings, escape aspas simples duplicando-as ('') e não com barra invertida.",
+		}
+	default:
+		return []string{
+			"O banco é PostgreSQL. Gere SQL compatível com PostgreSQL.",
+		}
+	}
+}
+
+// QuoteIdent delimita um identificador no dialeto, dobrando o delimitador
+// quando ele aparece no nome.
+func QuoteIdent(name, ident string) string {
+	if name == MySQL {
+		return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
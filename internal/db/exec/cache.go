@@ -0,0 +1,138 @@
+package exec
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"rag-sql/internal/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// resultCache guarda resultados já mascarados, indexados pelo SQL
+// normalizado (depois da reescrita de tenant) e pelo papel do chamador. O
+// tamanho de cada entrada é estimado pelo JSON do resultado.
+type resultCache struct {
+	cfg config.CacheConfig
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	byTable map[string]map[string]bool
+	size    int64
+}
+
+type cacheEntry struct {
+	key      string
+	result   *Result
+	tables   []string
+	size     int64
+	storedAt time.Time
+}
+
+func newResultCache(cfg config.CacheConfig) *resultCache {
+	if cfg.TTL <= 0 || cfg.MaxBytes <= 0 {
+		return nil
+	}
+	return &resultCache{
+		cfg:     cfg,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+		byTable: map[string]map[string]bool{},
+	}
+}
+
+func cacheKey(fingerprint, role string) string {
+	sum := sha256.Sum256([]byte(role + "\x00" + fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// get devolve uma cópia rasa do resultado; quem chama não deve alterar as
+// linhas, que são compartilhadas entre as respostas.
+func (c *resultCache) get(key string) (*Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Since(entry.storedAt) > c.cfg.TTL {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+
+	result := *entry.result
+	result.CacheStatus = CacheHit
+	result.CachedAt = entry.storedAt
+	return &result, true
+}
+
+func (c *resultCache) put(key string, result *Result, tables []string) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	size := int64(len(raw))
+	// resultados maiores que o cache inteiro não compensam
+	if size > c.cfg.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	entry := &cacheEntry{key: key, result: result, tables: tables, size: size, storedAt: time.Now()}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+	for _, t := range tables {
+		if c.byTable[t] == nil {
+			c.byTable[t] = map[string]bool{}
+		}
+		c.byTable[t][key] = true
+	}
+
+	for c.size > c.cfg.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate descarta os resultados que leram alguma das tabelas.
+func (c *resultCache) invalidate(tables []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range tables {
+		for key := range c.byTable[strings.ToLower(t)] {
+			if el, ok := c.entries[key]; ok {
+				c.remove(el)
+			}
+		}
+	}
+}
+
+func (c *resultCache) remove(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+	for _, t := range entry.tables {
+		delete(c.byTable[t], entry.key)
+		if len(c.byTable[t]) == 0 {
+			delete(c.byTable, t)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package exec
+
+import (
+	"encoding/json"
+	"rag-sql/internal/config"
+	"testing"
+	"time"
+)
+
+// cachedResult devolve um resultado e o tamanho que ele ocupa no cache.
+func cachedResult(t *testing.T, value string) (*Result, int64) {
+	t.Helper()
+	r := &Result{Columns: []Column{{Name: "v", TypeName: "text"}}, Rows: [][]any{{value}}}
+	raw, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, int64(len(raw))
+}
+
+func TestResultCacheDisabled(t *testing.T) {
+	if c := newResultCache(config.CacheConfig{TTL: time.Minute}); c != nil {
+		t.Fatal("cache sem MaxBytes deveria ficar desligado")
+	}
+	if c := newResultCache(config.CacheConfig{MaxBytes: 1 << 20}); c != nil {
+		t.Fatal("cache sem TTL deveria ficar desligado")
+	}
+}
+
+func TestResultCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	a, size := cachedResult(t, "a")
+	b, _ := cachedResult(t, "b")
+	d, _ := cachedResult(t, "d")
+	// cabem duas entradas
+	c := newResultCache(config.CacheConfig{TTL: time.Minute, MaxBytes: 2 * size})
+
+	c.put("a", a, nil)
+	c.put("b", b, nil)
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("a deveria estar no cache")
+	}
+	// b é agora a menos usada e sai para dar lugar a d
+	c.put("d", d, nil)
+
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b deveria ter saído do cache")
+	}
+	for _, key := range []string{"a", "d"} {
+		if _, ok := c.get(key); !ok {
+			t.Fatalf("%s deveria estar no cache", key)
+		}
+	}
+	if c.size != 2*size {
+		t.Fatalf("size = %d, want %d", c.size, 2*size)
+	}
+}
+
+func TestResultCacheSkipsOversizedResults(t *testing.T) {
+	r, size := cachedResult(t, "grande")
+	c := newResultCache(config.CacheConfig{TTL: time.Minute, MaxBytes: size - 1})
+
+	c.put("k", r, nil)
+	if _, ok := c.get("k"); ok || c.size != 0 {
+		t.Fatalf("resultado maior que o cache foi guardado (size = %d)", c.size)
+	}
+}
+
+func TestResultCacheExpires(t *testing.T) {
+	r, _ := cachedResult(t, "a")
+	c := newResultCache(config.CacheConfig{TTL: time.Minute, MaxBytes: 1 << 20})
+
+	c.put("k", r, []string{"public.orders"})
+	got, ok := c.get("k")
+	if !ok || got.CacheStatus != CacheHit || got.CachedAt.IsZero() {
+		t.Fatalf("get = %+v, %v; want hit", got, ok)
+	}
+
+	c.entries["k"].Value.(*cacheEntry).storedAt = time.Now().Add(-2 * time.Minute)
+	if _, ok := c.get("k"); ok {
+		t.Fatal("entrada vencida não deveria ser devolvida")
+	}
+	if len(c.entries) != 0 || len(c.byTable) != 0 || c.size != 0 {
+		t.Fatalf("entrada vencida não foi removida: %d entradas, %d tabelas, size %d", len(c.entries), len(c.byTable), c.size)
+	}
+}
+
+func TestResultCacheInvalidate(t *testing.T) {
+	a, _ := cachedResult(t, "a")
+	b, _ := cachedResult(t, "b")
+	c := newResultCache(config.CacheConfig{TTL: time.Minute, MaxBytes: 1 << 20})
+
+	c.put("a", a, []string{"public.orders", "public.users"})
+	c.put("b", b, []string{"public.users"})
+	c.invalidate([]string{"PUBLIC.ORDERS"})
+
+	if _, ok := c.get("a"); ok {
+		t.Fatal("a leu public.orders e deveria ter saído")
+	}
+	if _, ok := c.get("b"); !ok {
+		t.Fatal("b não leu public.orders e deveria continuar")
+	}
+}
@@ -0,0 +1,245 @@
+package exec
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq/oid"
+)
+
+type Column struct {
+	Name string `json:"name"`
+	// TypeOID só vem no Postgres, e não para tipos criados no banco.
+	TypeOID  uint32 `json:"type_oid,omitempty"`
+	TypeName string `json:"type"`
+	// Nullable vem do driver ou, no Postgres, do catálogo quando a coluna é
+	// uma coluna de tabela; fica vazio quando não se sabe.
+	Nullable     *bool  `json:"nullable,omitempty"`
+	SemanticType string `json:"semantic_type,omitempty"`
+	Masking      string `json:"masking,omitempty"`
+}
+
+var oidByName = func() map[string]oid.Oid {
+	m := make(map[string]oid.Oid, len(oid.TypeName))
+	for o, name := range oid.TypeName {
+		m[name] = o
+	}
+	return m
+}()
+
+func describeColumns(types []*sql.ColumnType, typeOIDs bool) []Column {
+	cols := make([]Column, len(types))
+	for i, ct := range types {
+		dbType := ct.DatabaseTypeName()
+
+		col := Column{Name: ct.Name(), TypeName: columnTypeName(dbType)}
+		if typeOIDs {
+			col.TypeOID = uint32(oidByName[dbType])
+		}
+		if nullable, ok := ct.Nullable(); ok {
+			col.Nullable = &nullable
+		}
+		cols[i] = col
+	}
+	return cols
+}
+
+func columnTypeName(dbType string) string {
+	name := strings.ToLower(dbType)
+	if name == "" {
+		return "unknown"
+	}
+	if strings.HasPrefix(name, "_") {
+		return name[1:] + "[]"
+	}
+	return name
+}
+
+// decodeValue converte o valor devolvido pelo driver para algo que
+// sobreviva ao JSON sem perder precisão nem formato.
+func decodeValue(col Column, val any) (any, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	if strings.HasSuffix(col.TypeName, "[]") {
+		b, ok := val.([]byte)
+		if !ok {
+			return val, nil
+		}
+		elem := Column{Name: col.Name, TypeName: strings.TrimSuffix(col.TypeName, "[]")}
+		return decodeArray(elem, string(b))
+	}
+
+	switch v := val.(type) {
+	case time.Time:
+		return formatTime(col.TypeName, v), nil
+	case []byte:
+		return decodeText(col.TypeName, v)
+	case float64:
+		return decodeFloat(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	default:
+		return v, nil
+	}
+}
+
+func decodeText(typeName string, b []byte) (any, error) {
+	switch typeName {
+	case "bytea", "blob", "tinyblob", "mediumblob", "longblob", "binary", "varbinary":
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "json", "jsonb":
+		if !json.Valid(b) {
+			return nil, fmt.Errorf("json inválido retornado pelo banco")
+		}
+		return json.RawMessage(append([]byte(nil), b...)), nil
+	default:
+		// numeric, uuid, interval, money e tipos desconhecidos seguem como texto
+		return string(b), nil
+	}
+}
+
+func decodeElement(typeName string, s string) (any, error) {
+	switch typeName {
+	case "int2", "int4", "int8", "oid":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		return s, nil
+	case "float4", "float8":
+		return decodeFloat(s), nil
+	case "bool":
+		return s == "t" || s == "true", nil
+	case "bytea":
+		// arrays de bytea chegam no formato hex do Postgres (\x...)
+		return s, nil
+	default:
+		return decodeText(typeName, []byte(s))
+	}
+}
+
+// decodeFloat mantém NaN e Infinity como texto, já que o JSON não os aceita.
+func decodeFloat(s string) any {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return s
+	}
+	return f
+}
+
+func formatTime(typeName string, t time.Time) string {
+	switch typeName {
+	case "date":
+		return t.Format("2006-01-02")
+	case "time":
+		return t.Format("15:04:05.999999")
+	case "timetz":
+		return t.Format("15:04:05.999999Z07:00")
+	case "timestamp", "datetime":
+		return t.Format("2006-01-02T15:04:05.999999")
+	default:
+		return t.Format(time.RFC3339Nano)
+	}
+}
+
+func decodeArray(elem Column, src string) (any, error) {
+	p := &arrayParser{src: src}
+	// arrays com limites explícitos vêm como "[1:3]={...}"
+	if strings.HasPrefix(p.src, "[") {
+		if i := strings.Index(p.src, "="); i >= 0 {
+			p.src = p.src[i+1:]
+		}
+	}
+
+	v, err := p.parse(elem.TypeName)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao decodificar array da coluna %s: %w", elem.Name, err)
+	}
+	return v, nil
+}
+
+type arrayParser struct {
+	src string
+	pos int
+}
+
+func (p *arrayParser) parse(elemType string) ([]any, error) {
+	if p.pos >= len(p.src) || p.src[p.pos] != '{' {
+		return nil, fmt.Errorf("esperado '{' na posição %d", p.pos)
+	}
+	p.pos++
+
+	items := []any{}
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '}':
+			p.pos++
+			return items, nil
+		case ',':
+			p.pos++
+		case '{':
+			sub, err := p.parse(elemType)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, sub)
+		case '"':
+			s, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeElement(elemType, s)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		default:
+			s := p.unquoted()
+			if strings.EqualFold(s, "NULL") {
+				items = append(items, nil)
+				continue
+			}
+			v, err := decodeElement(elemType, s)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+	}
+	return nil, fmt.Errorf("array não terminado")
+}
+
+func (p *arrayParser) quoted() (string, error) {
+	var sb strings.Builder
+	p.pos++
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '\\':
+			p.pos++
+			if p.pos < len(p.src) {
+				sb.WriteByte(p.src[p.pos])
+			}
+		case '"':
+			p.pos++
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+		}
+		p.pos++
+	}
+	return "", fmt.Errorf("aspas não terminadas")
+}
+
+func (p *arrayParser) unquoted() string {
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != ',' && p.src[p.pos] != '}' {
+		p.pos++
+	}
+	return strings.TrimSpace(p.src[start:p.pos])
+}
@@ -0,0 +1,95 @@
+package exec
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestColumnTypeName(t *testing.T) {
+	tests := map[string]string{
+		"INT4":    "int4",
+		"_TEXT":   "text[]",
+		"_int8":   "int8[]",
+		"VARCHAR": "varchar",
+		"":        "unknown",
+	}
+	for in, want := range tests {
+		if got := columnTypeName(in); got != want {
+			t.Errorf("columnTypeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTypeOIDByName(t *testing.T) {
+	// o lib/pq informa o nome do tipo em maiúsculas
+	if got := oidByName["INT4"]; got != 23 {
+		t.Fatalf("oid de INT4 = %d, want 23", got)
+	}
+	if got := oidByName["_TEXT"]; got != 1009 {
+		t.Fatalf("oid de _TEXT = %d, want 1009", got)
+	}
+	// tipos criados no banco ficam sem oid
+	if got := oidByName["MOOD"]; got != 0 {
+		t.Fatalf("oid de MOOD = %d, want 0", got)
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		typeName string
+		val      any
+		want     any
+	}{
+		{"nulo", "int4", nil, nil},
+		{"numeric como texto", "numeric", []byte("12345678901234567890.12"), "12345678901234567890.12"},
+		{"bytea em base64", "bytea", []byte{0xde, 0xad}, "3q0="},
+		{"json", "jsonb", []byte(`{"a": 1}`), json.RawMessage(`{"a": 1}`)},
+		{"float", "float8", 1.5, 1.5},
+		{"NaN fica texto", "float8", math.NaN(), "NaN"},
+		{"date", "date", ts, "2024-05-01"},
+		{"timestamp sem fuso", "timestamp", ts, "2024-05-01T12:30:00"},
+		{"timestamptz", "timestamptz", ts, "2024-05-01T12:30:00Z"},
+		{"array de inteiros", "int4[]", []byte("{1,2,NULL}"), []any{int64(1), int64(2), nil}},
+		{"array de texto com aspas", "text[]", []byte(`{"a,b","c\"d",e}`), []any{"a,b", `c"d`, "e"}},
+		{"array de bool", "bool[]", []byte("{t,f}"), []any{true, false}},
+		{"array aninhado", "int4[]", []byte("{{1,2},{3,4}}"), []any{[]any{int64(1), int64(2)}, []any{int64(3), int64(4)}}},
+		{"array com limites", "int4[]", []byte("[0:1]={7,8}"), []any{int64(7), int64(8)}},
+		{"array vazio", "text[]", []byte("{}"), []any{}},
+		{"array de float com Infinity", "float8[]", []byte("{1.5,Infinity}"), []any{1.5, "Infinity"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeValue(Column{Name: "c", TypeName: tt.typeName}, tt.val)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeValueErrors(t *testing.T) {
+	tests := []struct {
+		typeName string
+		val      []byte
+	}{
+		{"jsonb", []byte(`{"a":`)},
+		{"int4[]", []byte("{1,2")},
+		{"text[]", []byte(`{"abc}`)},
+		{"int4[]", []byte("1,2")},
+	}
+	for _, tt := range tests {
+		if _, err := decodeValue(Column{Name: "c", TypeName: tt.typeName}, tt.val); err == nil {
+			t.Errorf("decodeValue(%s, %q) sem erro", tt.typeName, tt.val)
+		}
+	}
+}
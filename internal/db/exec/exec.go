@@ -1,81 +1,349 @@
 package exec
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
-	"regexp"
-	"strconv"
+	"log"
+	"rag-sql/internal/config"
+	"rag-sql/internal/db/dialect"
 	"strings"
+	"time"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type Executor struct {
-	db *sql.DB
+	dialect   string
+	backend   backend
+	validator *Validator
+	scoper    *Scoper
+	masker    *Masker
+	cache     *resultCache
+	cfg       config.ExecConfig
+}
+
+// backend concentra o que muda entre dialetos: como abrir a transação
+// somente leitura, como obter o plano e como ler as linhas sem carregar
+// mais do que o limite.
+type backend interface {
+	begin(ctx context.Context) (*sql.Tx, error)
+	explain(ctx context.Context, tx *sql.Tx, query string) (*PlanSummary, error)
+	stream(ctx context.Context, tx *sql.Tx, query string, rs *rowStream) error
 }
 
-func New(db *sql.DB) *Executor {
-	return &Executor{db: db}
+// nullabilityReader é implementado pelos backends cujo driver não informa se
+// as colunas aceitam nulos.
+type nullabilityReader interface {
+	columnNullability(ctx context.Context, tx *sql.Tx, tables []string) (map[string]bool, error)
 }
 
-var forbiddenCommands = []string{
-	"delete", "update", "insert", "drop", "alter", "create", "truncate",
+// TxBeginner abre as transações de leitura. Um *sql.DB serve; um
+// db.Cluster distribui as consultas entre as réplicas.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
-func (e *Executor) Execute(sqlQuery string) ([]map[string]any, error) {
-	cleanSQL := strings.ToLower(strings.TrimSpace(sqlQuery))
+func New(db TxBeginner, dialectName string, cfg config.ExecConfig, policy config.SchemaPolicy) *Executor {
+	var b backend
+	switch dialectName {
+	case dialect.SQLite:
+		b = &sqliteBackend{db: db, cfg: cfg}
+	case dialect.MySQL:
+		b = &mysqlBackend{db: db, cfg: cfg}
+	default:
+		b = &postgresBackend{db: db, cfg: cfg}
+	}
 
-	if !strings.HasPrefix(cleanSQL, "select") {
-		return nil, errors.New("apenas comandos SELECT são permitidos")
+	return &Executor{
+		dialect:   dialectName,
+		backend:   b,
+		validator: NewValidator(cfg.DeniedFunctions, policy, dialect.DefaultSchema(dialectName)),
+		scoper:    NewScoper(cfg.TenantScopes),
+		masker:    NewMasker(cfg.Masking),
+		cache:     newResultCache(cfg.Cache),
+		cfg:       cfg,
 	}
+}
+
+type Result struct {
+	Columns        []Column     `json:"columns"`
+	Rows           [][]any      `json:"rows"`
+	Truncated      bool         `json:"truncated"`
+	DroppedColumns []string     `json:"dropped_columns,omitempty"`
+	Plan           *PlanSummary `json:"plan,omitempty"`
+	// TotalRows só é preenchido quando a contagem foi pedida em Page.Count.
+	TotalRows          *int64 `json:"total_rows,omitempty"`
+	TotalRowsEstimated bool   `json:"total_rows_estimated,omitempty"`
+	// NextOffset é o Offset da próxima página; zero quando não há.
+	NextOffset int `json:"-"`
+	// CacheStatus fica vazio quando o cache está desligado.
+	CacheStatus string    `json:"-"`
+	CachedAt    time.Time `json:"-"`
+}
+
+// Execute executa a primeira página da consulta, com o LIMIT padrão.
+func (e *Executor) Execute(ctx context.Context, sqlQuery string, caller Caller) (*Result, error) {
+	return e.ExecutePage(ctx, sqlQuery, caller, Page{})
+}
 
-	for _, cmd := range forbiddenCommands {
-		matched, _ := regexp.MatchString(`\b`+cmd+`\b`, cleanSQL)
-		if matched {
-			return nil, fmt.Errorf("comando proibido detectado: %s", cmd)
+// ExecutePage executa a consulta devolvendo só a janela pedida. O LIMIT e o
+// OFFSET são postos na própria consulta, que é reescrita a cada página.
+func (e *Executor) ExecutePage(ctx context.Context, sqlQuery string, caller Caller, page Page) (*Result, error) {
+	prep, err := e.prepare(sqlQuery, caller, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	// o resultado guardado já passou pelo mascaramento do papel, por isso o
+	// papel faz parte da chave
+	key := cacheKey(prep.fingerprint+prep.pageKey(), caller.Role)
+	if e.cache != nil {
+		if cached, ok := e.cache.get(key); ok {
+			return cached, nil
 		}
 	}
 
-	rows, err := e.db.Query(sqlQuery)
+	maxRows := e.cfg.MaxRows
+	if prep.limit.injected {
+		// a consulta traz uma linha além da página, que só marca o truncamento
+		maxRows = prep.size
+	}
+
+	collector := &resultCollector{}
+	summary, err := e.run(ctx, prep, caller, maxRows, collector)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	cols, err := rows.Columns()
+	result := &Result{
+		Columns:            collector.columns,
+		Rows:               collector.rows,
+		Truncated:          summary.Truncated,
+		DroppedColumns:     summary.DroppedColumns,
+		Plan:               summary.Plan,
+		TotalRows:          summary.TotalRows,
+		TotalRowsEstimated: summary.TotalRowsEstimated,
+	}
+	if summary.Truncated && prep.limit.pageable {
+		result.NextOffset = prep.offset + len(result.Rows)
+	}
+	if prep.count != "" && !summary.Truncated {
+		// sem truncamento o total já é conhecido
+		total := int64(prep.offset + len(result.Rows))
+		result.TotalRows = &total
+	}
+
+	if e.cache != nil {
+		e.cache.put(key, result, prep.tables)
+		result.CacheStatus = CacheMiss
+	}
+	return result, nil
+}
+
+// Stream executa a consulta entregando as linhas ao RowWriter conforme
+// chegam do banco, com o limite de linhas de exportação. O cache não é
+// usado.
+func (e *Executor) Stream(ctx context.Context, sqlQuery string, caller Caller, w RowWriter) (*StreamSummary, error) {
+	prep, err := e.prepare(sqlQuery, caller, nil)
 	if err != nil {
 		return nil, err
 	}
+	return e.run(ctx, prep, caller, e.cfg.ExportMaxRows, w)
+}
 
-	var results []map[string]any
-	for rows.Next() {
-		values := make([]any, len(cols))
-		pointers := make([]any, len(cols))
-		for i := range values {
-			pointers[i] = &values[i]
-		}
+func (e *Executor) run(ctx context.Context, prep *preparedQuery, caller Caller, maxRows int, w RowWriter) (*StreamSummary, error) {
+	tx, err := e.backend.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// a transação é somente leitura, então nunca há o que confirmar
+	defer tx.Rollback()
 
-		if err := rows.Scan(pointers...); err != nil {
+	plan, err := e.backend.explain(ctx, tx, prep.query)
+	if err != nil {
+		return nil, err
+	}
+	e.checkBudget(plan)
+	if len(plan.Violations) > 0 {
+		return nil, &BudgetError{Plan: plan}
+	}
+
+	masked := e.masker.wrap(w, prep.sources, caller)
+	rs := &rowStream{w: masked, maxRows: maxRows, typeOIDs: e.dialect == dialect.Postgres, sources: prep.sources}
+	if nr, ok := e.backend.(nullabilityReader); ok {
+		if rs.nullable, err = nr.columnNullability(ctx, tx, prep.sources.tables()); err != nil {
 			return nil, err
 		}
+	}
+	if err := e.backend.stream(ctx, tx, prep.query, rs); err != nil {
+		return nil, err
+	}
+	if err := masked.finish(); err != nil {
+		return nil, err
+	}
 
-		row := make(map[string]any)
-		for i, col := range cols {
-			val := values[i]
+	summary := &StreamSummary{Plan: plan, Truncated: rs.truncated, DroppedColumns: masked.dropped}
+	if prep.count != "" && rs.truncated {
+		total, estimated, err := e.countRows(ctx, tx, prep)
+		if err != nil {
+			// o total é informativo; a página já foi lida
+			log.Printf("erro ao contar linhas: %v", err)
+		} else {
+			summary.TotalRows, summary.TotalRowsEstimated = &total, estimated
+		}
+	}
+	return summary, nil
+}
 
-			if b, ok := val.([]byte); ok {
-				strVal := string(b)
+// InvalidateTables descarta do cache os resultados que leram as tabelas,
+// dadas como "schema.tabela" ou só pelo nome.
+func (e *Executor) InvalidateTables(tables []string) {
+	if e.cache == nil {
+		return
+	}
+	// no MySQL as consultas sem schema ficam indexadas só pelo nome
+	var names []string
+	for _, t := range tables {
+		names = append(names, t)
+		if _, name, ok := strings.Cut(t, "."); ok {
+			names = append(names, name)
+		}
+	}
+	e.cache.invalidate(names)
+}
 
-				if f, err := strconv.ParseFloat(strVal, 64); err == nil {
-					row[col] = f
-				} else {
-					row[col] = strVal
-				}
-			} else {
-				row[col] = val
-			}
+// BlockUnscopedViews passa a recusar as views que leem tabelas com escopo de
+// tenant sem ter escopo próprio e as devolve. deps vem de
+// dbschema.Service.ViewDependencies.
+func (e *Executor) BlockUnscopedViews(deps map[string][]string) []string {
+	views := e.scoper.UnscopedViews(deps)
+	e.scoper.Block(views)
+	return views
+}
+
+// Explain valida a consulta e devolve o resumo do plano sem executá-la.
+func (e *Executor) Explain(ctx context.Context, sqlQuery string, caller Caller) (*PlanSummary, error) {
+	prep, err := e.prepare(sqlQuery, caller, &Page{})
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := e.backend.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	plan, err := e.backend.explain(ctx, tx, prep.query)
+	if err != nil {
+		return nil, err
+	}
+	e.checkBudget(plan)
+	return plan, nil
+}
+
+type preparedQuery struct {
+	// query é o SQL enviado ao banco
+	query   string
+	sources *columnSources
+	// tables são as tabelas lidas, usadas para invalidar o cache
+	tables []string
+	// fingerprint é o SQL normalizado depois da reescrita de tenant
+	fingerprint string
+
+	// unpaged é a consulta sem a paginação, usada na contagem
+	unpaged string
+	limit   pageLimit
+	offset  int
+	size    int
+	count   string
+}
+
+// prepare valida e reescreve a consulta. Sem page nenhum LIMIT é posto.
+func (e *Executor) prepare(sqlQuery string, caller Caller, page *Page) (*preparedQuery, error) {
+	// a validação usa a gramática do Postgres também para os outros
+	// dialetos, depois de trocar as aspas de identificadores por aspas duplas
+	normalized, err := normalizeQuoting(e.dialect, sqlQuery)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := e.validator.Validate(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	// a origem das colunas é resolvida antes da reescrita de tenant
+	prep := &preparedQuery{sources: resolveSources(tree, dialect.DefaultSchema(e.dialect)), tables: referencedTables(tree, dialect.DefaultSchema(e.dialect))}
+
+	rewritten, err := e.scoper.Rewrite(tree, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	if prep.fingerprint, err = pg.Deparse(tree); err != nil {
+		return nil, fmt.Errorf("erro ao reconstruir SQL: %w", err)
+	}
+
+	if e.dialect == dialect.Postgres {
+		prep.query = prep.fingerprint
+		prep.unpaged = prep.query
+		if err := e.paginate(prep, tree, page); err != nil {
+			return nil, err
 		}
-		results = append(results, row)
+		return prep, nil
+	}
+
+	// o SQL reconstruído a partir da árvore é Postgres; em outros dialetos a
+	// consulta original é executada e a reescrita não é segura
+	if rewritten {
+		return nil, &ValidationError{Rejections: []Rejection{{
+			Code:    "tenant_scope",
+			Message: fmt.Sprintf("escopo de tenant não é suportado no dialeto %s", e.dialect),
+		}}}
+	}
+	prep.query = strings.TrimRight(strings.TrimSpace(sqlQuery), "; \n\t")
+	prep.unpaged = prep.query
+	if err := e.paginate(prep, tree, page); err != nil {
+		return nil, err
 	}
+	return prep, nil
+}
 
-	return results, nil
+// referencedTables lista, em minúsculas e como "schema.tabela", as tabelas
+// reais citadas na consulta (CTEs ficam de fora). Tabelas sem schema ficam no
+// padrão do dialeto, ou só com o nome quando não há padrão.
+func referencedTables(tree *pg.ParseResult, defaultSchema string) []string {
+	cteNames := map[string]bool{}
+	var rangeVars []*pg.RangeVar
+	for _, raw := range tree.Stmts {
+		walk(raw.Stmt, func(m protoreflect.ProtoMessage) {
+			switch n := m.(type) {
+			case *pg.CommonTableExpr:
+				cteNames[strings.ToLower(n.Ctename)] = true
+			case *pg.RangeVar:
+				rangeVars = append(rangeVars, n)
+			}
+		})
+	}
+
+	seen := map[string]bool{}
+	var tables []string
+	for _, rv := range rangeVars {
+		name := strings.ToLower(rv.Relname)
+		if rv.Schemaname == "" && cteNames[name] {
+			continue
+		}
+		if schema := cmp.Or(rv.Schemaname, defaultSchema); schema != "" {
+			name = strings.ToLower(schema) + "." + name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		tables = append(tables, name)
+	}
+	return tables
 }
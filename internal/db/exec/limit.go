@@ -0,0 +1,255 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"rag-sql/internal/db/dialect"
+	"strings"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Page pede uma janela do resultado. Size zero usa o LIMIT padrão; Count
+// pede o total de linhas ("exact" ou "estimate").
+type Page struct {
+	Offset int
+	Size   int
+	Count  string
+}
+
+const (
+	CountExact    = "exact"
+	CountEstimate = "estimate"
+)
+
+var aggregateFunctions = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+	"bool_and": true, "bool_or": true, "every": true,
+	"string_agg": true, "array_agg": true, "group_concat": true, "total": true,
+	"json_agg": true, "jsonb_agg": true, "json_object_agg": true, "jsonb_object_agg": true,
+	"stddev": true, "stddev_pop": true, "stddev_samp": true,
+	"variance": true, "var_pop": true, "var_samp": true,
+	"percentile_cont": true, "percentile_disc": true, "mode": true,
+}
+
+// paginate aplica a página à consulta preparada. Pedir uma página além da
+// primeira de uma consulta que não pode ser paginada é um erro de validação.
+func (e *Executor) paginate(prep *preparedQuery, tree *pg.ParseResult, page *Page) error {
+	if page == nil {
+		return nil
+	}
+	prep.offset, prep.size, prep.count = max(page.Offset, 0), e.pageSize(*page), page.Count
+
+	var stmt *pg.SelectStmt
+	if len(tree.Stmts) == 1 {
+		stmt = tree.Stmts[0].Stmt.GetSelectStmt()
+	}
+	if stmt != nil && prep.size > 0 {
+		if e.dialect == dialect.Postgres {
+			if prep.limit = applyPage(stmt, prep.offset, prep.size); prep.limit.injected {
+				query, err := pg.Deparse(tree)
+				if err != nil {
+					return fmt.Errorf("erro ao reconstruir SQL: %w", err)
+				}
+				prep.query = query
+			}
+		} else {
+			prep.query, prep.limit = appendPage(prep.query, stmt, prep.offset, prep.size)
+		}
+	}
+
+	if prep.offset > 0 && !prep.limit.pageable {
+		return &ValidationError{Rejections: []Rejection{{
+			Code:    "pagination",
+			Message: "paginação não suportada para esta consulta",
+		}}}
+	}
+	return nil
+}
+
+// pageSize é o tamanho da página pedido ou o LIMIT padrão, nunca acima de
+// MaxRows. Zero indica que nenhum LIMIT deve ser posto.
+func (e *Executor) pageSize(page Page) int {
+	size := page.Size
+	if size <= 0 {
+		size = e.cfg.DefaultLimit
+	}
+	if size <= 0 && page.Offset > 0 {
+		size = e.cfg.MaxRows
+	}
+	if e.cfg.MaxRows > 0 && size > e.cfg.MaxRows {
+		size = e.cfg.MaxRows
+	}
+	return size
+}
+
+// pageKey diferencia no cache as páginas de uma mesma consulta.
+func (p *preparedQuery) pageKey() string {
+	return fmt.Sprintf("\x00%d\x00%d\x00%s", p.offset, p.size, p.count)
+}
+
+var errNoEstimate = errors.New("o plano não traz estimativa de linhas")
+
+// countRows conta as linhas da consulta sem a paginação. O count(*) só roda
+// quando o plano cabe no orçamento; do contrário, e quando a estimativa é
+// pedida, vale a estimativa do plano (que o SQLite não tem).
+func (e *Executor) countRows(ctx context.Context, tx *sql.Tx, prep *preparedQuery) (int64, bool, error) {
+	plan, err := e.backend.explain(ctx, tx, prep.unpaged)
+	if err != nil {
+		return 0, false, err
+	}
+	e.checkBudget(plan)
+
+	if plan.EstimatedRows > 0 && (prep.count == CountEstimate || len(plan.Violations) > 0) {
+		return int64(plan.EstimatedRows), true, nil
+	}
+	if len(plan.Violations) > 0 {
+		return 0, false, errNoEstimate
+	}
+
+	if e.cfg.StatementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.cfg.StatementTimeout)
+		defer cancel()
+	}
+
+	var total int64
+	query := "SELECT count(*) FROM (\n" + prep.unpaged + "\n) AS rag_sql_count"
+	if err := tx.QueryRowContext(ctx, query).Scan(&total); err != nil {
+		return 0, false, err
+	}
+	return total, false, nil
+}
+
+// pageLimit descreve como a página foi aplicada à consulta.
+type pageLimit struct {
+	// injected indica que o LIMIT/OFFSET da consulta foi alterado
+	injected bool
+	// pageable indica que dá para pedir as páginas seguintes
+	pageable bool
+}
+
+// applyPage ajusta o LIMIT/OFFSET do SELECT externo para devolver a página
+// pedida mais uma linha, que serve só para saber se há próxima página. Um
+// LIMIT/OFFSET constante já presente na consulta é respeitado; com valores
+// não constantes, WITH TIES ou agregação sem GROUP BY a consulta fica como
+// está e só a primeira página existe.
+func applyPage(stmt *pg.SelectStmt, offset, size int) pageLimit {
+	if stmt.LimitOption == pg.LimitOption_LIMIT_OPTION_WITH_TIES || isSingleRowAggregate(stmt) {
+		return pageLimit{}
+	}
+
+	userOffset, offsetConst := constantLimit(stmt.LimitOffset)
+	userOffset = max(userOffset, 0)
+	userCount, countConst := constantLimit(stmt.LimitCount)
+	if !offsetConst || !countConst {
+		return pageLimit{}
+	}
+
+	count := int64(size + 1)
+	if userCount >= 0 {
+		count = min(max(userCount-int64(offset), 0), count)
+	}
+
+	stmt.LimitCount = pg.MakeAConstIntNode(count, -1)
+	stmt.LimitOption = pg.LimitOption_LIMIT_OPTION_COUNT
+	if total := userOffset + int64(offset); total > 0 {
+		stmt.LimitOffset = pg.MakeAConstIntNode(total, -1)
+	}
+	return pageLimit{injected: true, pageable: true}
+}
+
+// constantLimit lê um LIMIT/OFFSET inteiro; ausente ou LIMIT ALL vira -1 e
+// ok é falso para expressões.
+func constantLimit(n *pg.Node) (int64, bool) {
+	if n == nil {
+		return -1, true
+	}
+	c := n.GetAConst()
+	if c == nil {
+		return 0, false
+	}
+	if c.Isnull {
+		return -1, true
+	}
+	if i := c.GetIval(); i != nil {
+		return int64(i.Ival), true
+	}
+	return 0, false
+}
+
+// appendPage é o applyPage dos dialetos em que o SQL original é executado:
+// só consultas sem LIMIT/OFFSET recebem o LIMIT, anexado ao texto em uma
+// nova linha para não cair dentro de um comentário no fim da consulta.
+func appendPage(query string, stmt *pg.SelectStmt, offset, size int) (string, pageLimit) {
+	if stmt.LimitCount != nil || stmt.LimitOffset != nil || isSingleRowAggregate(stmt) {
+		return query, pageLimit{}
+	}
+
+	query += fmt.Sprintf("\nLIMIT %d", size+1)
+	if offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return query, pageLimit{injected: true, pageable: true}
+}
+
+// isSingleRowAggregate reconhece SELECTs com agregação e sem GROUP BY, que
+// sempre devolvem uma linha.
+func isSingleRowAggregate(stmt *pg.SelectStmt) bool {
+	if stmt.Op != pg.SetOperation_SETOP_NONE || len(stmt.GroupClause) > 0 {
+		return false
+	}
+	if stmt.HavingClause != nil {
+		return true
+	}
+	for _, target := range stmt.TargetList {
+		if containsAggregate(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAggregate procura funções de agregação fora de subconsultas e de
+// funções de janela.
+func containsAggregate(m protoreflect.ProtoMessage) bool {
+	if m == nil {
+		return false
+	}
+	msg := m.ProtoReflect()
+	if !msg.IsValid() {
+		return false
+	}
+
+	switch n := m.(type) {
+	case *pg.SubLink:
+		return false
+	case *pg.FuncCall:
+		if n.Over == nil && len(n.Funcname) > 0 {
+			name := strings.ToLower(n.Funcname[len(n.Funcname)-1].GetString_().GetSval())
+			if aggregateFunctions[name] {
+				return true
+			}
+		}
+	}
+
+	found := false
+	msg.Range(func(fd protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsMap() {
+			return true
+		}
+		if fd.IsList() {
+			list := val.List()
+			for i := 0; i < list.Len() && !found; i++ {
+				found = containsAggregate(list.Get(i).Message().Interface())
+			}
+			return !found
+		}
+		found = containsAggregate(val.Message().Interface())
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,69 @@
+package exec
+
+import (
+	"rag-sql/internal/config"
+	"rag-sql/internal/db/dialect"
+	"testing"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+)
+
+func TestPaginate(t *testing.T) {
+	cfg := config.ExecConfig{DefaultLimit: 100, MaxRows: 1000}
+
+	tests := []struct {
+		name     string
+		dialect  string
+		sql      string
+		page     Page
+		want     string
+		pageable bool
+		reject   bool
+	}{
+		{"limite padrão", dialect.Postgres, "SELECT * FROM t", Page{}, "SELECT * FROM t LIMIT 101", true, false},
+		{"segunda página", dialect.Postgres, "SELECT * FROM t", Page{Offset: 20, Size: 10}, "SELECT * FROM t LIMIT 11 OFFSET 20", true, false},
+		{"teto de MaxRows", dialect.Postgres, "SELECT * FROM t", Page{Size: 5000}, "SELECT * FROM t LIMIT 1001", true, false},
+		{"limit do usuário menor", dialect.Postgres, "SELECT * FROM t LIMIT 5", Page{}, "SELECT * FROM t LIMIT 5", true, false},
+		{"página além do limit do usuário", dialect.Postgres, "SELECT * FROM t LIMIT 15", Page{Offset: 10, Size: 10}, "SELECT * FROM t LIMIT 5 OFFSET 10", true, false},
+		{"offset do usuário somado", dialect.Postgres, "SELECT * FROM t OFFSET 3", Page{Offset: 10, Size: 10}, "SELECT * FROM t LIMIT 11 OFFSET 13", true, false},
+		{"limit não constante", dialect.Postgres, "SELECT * FROM t LIMIT (SELECT 1)", Page{}, "SELECT * FROM t LIMIT (SELECT 1)", false, false},
+		{"agregação sem group by", dialect.Postgres, "SELECT count(*) FROM t", Page{}, "SELECT count(*) FROM t", false, false},
+		{"with ties não pagina", dialect.Postgres, "SELECT * FROM t ORDER BY a FETCH FIRST 3 ROWS WITH TIES", Page{Offset: 10}, "", false, true},
+		{"mysql anexa o limit", dialect.MySQL, "SELECT * FROM t -- fim", Page{Offset: 10, Size: 10}, "SELECT * FROM t -- fim\nLIMIT 11 OFFSET 10", true, false},
+		{"mysql com limit do usuário", dialect.MySQL, "SELECT * FROM t LIMIT 5", Page{}, "SELECT * FROM t LIMIT 5", false, false},
+		{"mysql sem página seguinte", dialect.MySQL, "SELECT * FROM t LIMIT 5", Page{Offset: 5}, "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pg.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := &Executor{dialect: tt.dialect, cfg: cfg}
+			prep := &preparedQuery{query: tt.sql}
+			if tt.dialect == dialect.Postgres {
+				if prep.query, err = pg.Deparse(tree); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = e.paginate(prep, tree, &tt.page)
+			if tt.reject {
+				if codes := rejectionCodes(t, err); len(codes) != 1 || codes[0] != "pagination" {
+					t.Fatalf("esperava pagination, veio %v", codes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if prep.query != tt.want {
+				t.Fatalf("got %q, want %q", prep.query, tt.want)
+			}
+			if prep.limit.pageable != tt.pageable {
+				t.Fatalf("pageable = %v, want %v", prep.limit.pageable, tt.pageable)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package exec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"rag-sql/internal/config"
+	"rag-sql/internal/db/pii"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaskRedact  = "redact"
+	MaskHash    = "hash"
+	MaskPartial = "partial"
+	MaskDrop    = "drop"
+)
+
+type Masker struct {
+	cfg config.MaskingConfig
+}
+
+func NewMasker(cfg config.MaskingConfig) *Masker {
+	return &Masker{cfg: cfg}
+}
+
+func (m *Masker) policyFor(role string) config.MaskingPolicy {
+	if p, ok := m.cfg.Roles[role]; ok {
+		return p
+	}
+	return m.cfg.Default
+}
+
+// maskSampleRows é quantas linhas são lidas antes de decidir o tipo
+// semântico de cada coluna.
+const maskSampleRows = 50
+
+// maskingWriter mascara as linhas conforme a política do papel do chamador
+// antes de repassá-las. As primeiras linhas ficam retidas até que o tipo
+// semântico das colunas seja detectado; colunas com estratégia drop saem do
+// resultado.
+type maskingWriter struct {
+	m       *Masker
+	policy  config.MaskingPolicy
+	sources *columnSources
+	next    RowWriter
+
+	columns    []Column
+	sample     [][]any
+	decided    bool
+	strategies []string
+	semantics  []string
+	keep       []int
+	dropped    []string
+}
+
+func (m *Masker) wrap(next RowWriter, sources *columnSources, caller Caller) *maskingWriter {
+	return &maskingWriter{m: m, policy: m.policyFor(caller.Role), sources: sources, next: next}
+}
+
+func (w *maskingWriter) WriteHeader(columns []Column) error {
+	w.columns = columns
+	if len(w.policy.Columns) == 0 && len(w.policy.SemanticTypes) == 0 {
+		w.decided = true
+		return w.next.WriteHeader(columns)
+	}
+	return nil
+}
+
+func (w *maskingWriter) WriteRow(row []any) error {
+	if w.decided {
+		return w.next.WriteRow(w.apply(row))
+	}
+
+	w.sample = append(w.sample, row)
+	if len(w.sample) < maskSampleRows {
+		return nil
+	}
+	return w.decide()
+}
+
+// finish libera as linhas retidas quando o resultado é menor que a amostra.
+func (w *maskingWriter) finish() error {
+	if w.decided {
+		return nil
+	}
+	return w.decide()
+}
+
+func (w *maskingWriter) decide() error {
+	w.decided = true
+	w.strategies = make([]string, len(w.columns))
+	w.semantics = make([]string, len(w.columns))
+
+	columns := make([]Column, 0, len(w.columns))
+	for i, col := range w.columns {
+		strategy, semantic := w.m.strategyFor(w.policy, w.sources.lookup(col.Name), columnValues(w.sample, i))
+		col.SemanticType = semantic
+		w.strategies[i] = strategy
+		w.semantics[i] = semantic
+
+		if strategy == MaskDrop {
+			w.dropped = append(w.dropped, col.Name)
+			continue
+		}
+		if strategy != "" {
+			col.Masking = strategy
+		}
+		w.keep = append(w.keep, i)
+		columns = append(columns, col)
+	}
+
+	if err := w.next.WriteHeader(columns); err != nil {
+		return err
+	}
+	for _, row := range w.sample {
+		if err := w.next.WriteRow(w.apply(row)); err != nil {
+			return err
+		}
+	}
+	w.sample = nil
+	return nil
+}
+
+func (w *maskingWriter) apply(row []any) []any {
+	if w.strategies == nil {
+		return row
+	}
+
+	out := make([]any, 0, len(w.keep))
+	for _, i := range w.keep {
+		val := row[i]
+		if s := w.strategies[i]; s != "" {
+			val = w.m.mask(s, w.semantics[i], val)
+		}
+		out = append(out, val)
+	}
+	return out
+}
+
+// strategyFor escolhe a estratégia da coluna. Regras explícitas das colunas
+// de origem vêm antes das por tipo semântico; quando a coluna deriva de
+// várias origens, vale a mais restritiva.
+func (m *Masker) strategyFor(policy config.MaskingPolicy, src columnSource, values []any) (string, string) {
+	semantic := pii.Detect(src.Column, values)
+
+	var explicit, bySemantic []string
+	if len(src.Origins) == 0 {
+		// sem a tabela de origem, qualquer regra para a coluna vale
+		for key, s := range policy.Columns {
+			if i := strings.LastIndex(key, "."); i >= 0 && key[i+1:] == src.Column {
+				explicit = append(explicit, s)
+			}
+		}
+	}
+	for _, o := range src.Origins {
+		if o.Column == "" {
+			// a linha inteira pode trazer qualquer coluna mascarada da tabela
+			explicit = append(explicit, wholeRowStrategies(policy, o.Table)...)
+			continue
+		}
+		// a regra mais específica vence: schema.tabela.coluna, tabela.coluna
+		// e por fim *.coluna
+		for _, table := range append(tableKeys(o.Table), "*") {
+			if s, ok := policy.Columns[table+"."+o.Column]; ok {
+				explicit = append(explicit, s)
+				break
+			}
+		}
+		if sem := pii.Detect(o.Column, nil); sem != "" {
+			if semantic == "" {
+				semantic = sem
+			}
+			if s, ok := policy.SemanticTypes[sem]; ok {
+				bySemantic = append(bySemantic, s)
+			}
+		}
+	}
+	if len(explicit) > 0 {
+		return strictest(explicit), semantic
+	}
+
+	if semantic != "" {
+		if s, ok := policy.SemanticTypes[semantic]; ok {
+			bySemantic = append(bySemantic, s)
+		}
+	}
+	return strictest(bySemantic), semantic
+}
+
+// wholeRowStrategies devolve as estratégias que podem valer para alguma
+// coluna da tabela. A máscara parcial vira redact, pois sobre a linha inteira
+// ela deixaria o fim do último valor à mostra.
+func wholeRowStrategies(policy config.MaskingPolicy, table string) []string {
+	var strategies []string
+	tables := append(tableKeys(table), "*")
+	for key, s := range policy.Columns {
+		if i := strings.LastIndex(key, "."); i >= 0 && slices.Contains(tables, key[:i]) {
+			strategies = append(strategies, s)
+		}
+	}
+	// sem as colunas da tabela, qualquer tipo semântico pode estar nela
+	for _, s := range policy.SemanticTypes {
+		strategies = append(strategies, s)
+	}
+	for i, s := range strategies {
+		if s == MaskPartial {
+			strategies[i] = MaskRedact
+		}
+	}
+	return strategies
+}
+
+// tableKeys devolve os nomes pelos quais a política pode citar a tabela, do
+// mais para o menos específico: "public.users" e "users".
+func tableKeys(table string) []string {
+	if _, name, ok := strings.Cut(table, "."); ok {
+		return []string{table, name}
+	}
+	return []string{table}
+}
+
+// strictness ordena as estratégias da menos para a mais restritiva.
+var strictness = map[string]int{MaskPartial: 1, MaskHash: 2, MaskRedact: 3, MaskDrop: 4}
+
+func strictest(strategies []string) string {
+	best := ""
+	for _, s := range strategies {
+		if strictness[s] > strictness[best] {
+			best = s
+		}
+	}
+	return best
+}
+
+func columnValues(rows [][]any, i int) []any {
+	const sample = 50
+	values := make([]any, 0, min(len(rows), sample))
+	for _, row := range rows {
+		if len(values) == sample {
+			break
+		}
+		if row[i] != nil {
+			values = append(values, row[i])
+		}
+	}
+	return values
+}
+
+func (m *Masker) mask(strategy, semantic string, val any) any {
+	if val == nil {
+		return nil
+	}
+	s := fmt.Sprint(val)
+
+	switch strategy {
+	case MaskRedact:
+		return "***"
+	case MaskHash:
+		sum := sha256.Sum256([]byte(m.cfg.HashSalt + s))
+		return hex.EncodeToString(sum[:])
+	case MaskPartial:
+		return partialMask(semantic, s)
+	default:
+		return val
+	}
+}
+
+func partialMask(semantic, s string) string {
+	switch semantic {
+	case "cpf":
+		digits := onlyDigits(s)
+		if len(digits) == 11 {
+			return "***." + digits[3:6] + "." + digits[6:9] + "-**"
+		}
+	case "email":
+		if user, domain, ok := strings.Cut(s, "@"); ok && user != "" {
+			first, _ := utf8.DecodeRuneInString(user)
+			return string(first) + "***@" + domain
+		}
+	case "phone":
+		digits := onlyDigits(s)
+		if len(digits) >= 4 {
+			return strings.Repeat("*", len(digits)-4) + digits[len(digits)-4:]
+		}
+	}
+
+	runes := []rune(s)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+}
+
+func onlyDigits(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
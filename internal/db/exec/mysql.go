@@ -0,0 +1,170 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"rag-sql/internal/config"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mysqlBackend executa consultas em MySQL ou MariaDB. Os limites de tempo
+// usam variáveis de sessão, que mudam de nome entre os dois servidores.
+type mysqlBackend struct {
+	db  TxBeginner
+	cfg config.ExecConfig
+
+	detectOnce sync.Once
+	mariaDB    bool
+}
+
+func (m *mysqlBackend) begin(ctx context.Context) (*sql.Tx, error) {
+	// o driver abre com START TRANSACTION READ ONLY
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao iniciar transação: %w", err)
+	}
+
+	m.detectOnce.Do(func() {
+		var version string
+		if err := tx.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err == nil {
+			m.mariaDB = strings.Contains(strings.ToLower(version), "mariadb")
+		}
+	})
+
+	if err := m.applySessionLimits(ctx, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// applySessionLimits ajusta as variáveis da sessão a cada transação, já que
+// a conexão volta para o pool com os valores da última consulta.
+func (m *mysqlBackend) applySessionLimits(ctx context.Context, tx *sql.Tx) error {
+	statement := m.cfg.StatementTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); statement <= 0 || remaining < statement {
+			statement = max(remaining, time.Millisecond)
+		}
+	}
+
+	var settings []string
+	// no MariaDB o limite é em segundos (aceita fração); no MySQL, em ms
+	if m.mariaDB {
+		settings = append(settings, "max_statement_time = "+strconv.FormatFloat(statement.Seconds(), 'f', 3, 64))
+	} else {
+		settings = append(settings, "max_execution_time = "+strconv.FormatInt(statement.Milliseconds(), 10))
+	}
+	// os timeouts de lock e ociosidade são inteiros em segundos, mínimo 1
+	if m.cfg.LockTimeout > 0 {
+		settings = append(settings,
+			"innodb_lock_wait_timeout = "+mysqlSeconds(m.cfg.LockTimeout),
+			"lock_wait_timeout = "+mysqlSeconds(m.cfg.LockTimeout),
+		)
+	}
+	if m.cfg.IdleInTransactionTimeout > 0 {
+		settings = append(settings, "wait_timeout = "+mysqlSeconds(m.cfg.IdleInTransactionTimeout))
+	}
+
+	if _, err := tx.ExecContext(ctx, "SET SESSION "+strings.Join(settings, ", ")); err != nil {
+		return fmt.Errorf("erro ao configurar limites da sessão: %w", err)
+	}
+	return nil
+}
+
+func mysqlSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(max(math.Ceil(d.Seconds()), 1)), 10)
+}
+
+func (m *mysqlBackend) stream(ctx context.Context, tx *sql.Tx, query string, rs *rowStream) error {
+	// ao fechar as linhas o driver lê o resto do resultado; cancelar o
+	// contexto antes faz ele abandonar a conexão em vez de ler tudo
+	ctx, cancel := context.WithCancel(ctx)
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		cancel()
+		return err
+	}
+	defer func() {
+		cancel()
+		rows.Close()
+	}()
+
+	_, err = rs.scan(rows)
+	return err
+}
+
+// explain lê o EXPLAIN FORMAT=JSON. O custo total só existe no MySQL; o
+// MariaDB informa apenas as linhas por tabela. Em varreduras completas o
+// total de linhas da tabela é a própria estimativa de linhas lidas, e o nome
+// mostrado pode ser o alias.
+func (m *mysqlBackend) explain(ctx context.Context, tx *sql.Tx, query string) (*PlanSummary, error) {
+	var raw string
+	if err := tx.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+query).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("erro ao executar EXPLAIN: %w", err)
+	}
+
+	var plan map[string]any
+	if err := json.Unmarshal([]byte(raw), &plan); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar plano: %w", err)
+	}
+
+	summary := &PlanSummary{}
+	if block, ok := plan["query_block"].(map[string]any); ok {
+		if cost, ok := block["cost_info"].(map[string]any); ok {
+			summary.TotalCost = jsonNumber(cost["query_cost"])
+		}
+	}
+
+	var collect func(v any)
+	collect = func(v any) {
+		switch node := v.(type) {
+		case map[string]any:
+			if name, ok := node["table_name"].(string); ok && node["access_type"] == "ALL" {
+				rows := jsonNumber(node["rows_examined_per_scan"])
+				if rows == 0 {
+					rows = jsonNumber(node["rows"])
+				}
+				summary.SeqScans = append(summary.SeqScans, SeqScan{
+					Table:         name,
+					EstimatedRows: rows,
+					TableRows:     rows,
+				})
+			}
+			// chaves em ordem para que as varreduras saiam sempre na mesma ordem
+			for _, key := range slices.Sorted(maps.Keys(node)) {
+				collect(node[key])
+			}
+		case []any:
+			for _, child := range node {
+				collect(child)
+			}
+		}
+	}
+	collect(plan)
+
+	return summary, nil
+}
+
+// jsonNumber aceita números e strings numéricas, já que o MySQL devolve
+// custos como texto ("12.50").
+func jsonNumber(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,43 @@
+package exec
+
+import (
+	"fmt"
+	"strings"
+)
+
+type SeqScan struct {
+	Table         string  `json:"table"`
+	EstimatedRows float64 `json:"estimated_rows"`
+	TableRows     float64 `json:"table_rows"`
+}
+
+type PlanSummary struct {
+	TotalCost     float64   `json:"total_cost"`
+	EstimatedRows float64   `json:"estimated_rows"`
+	SeqScans      []SeqScan `json:"seq_scans,omitempty"`
+	Violations    []string  `json:"violations,omitempty"`
+}
+
+type BudgetError struct {
+	Plan *PlanSummary
+}
+
+func (e *BudgetError) Error() string {
+	return "consulta excede o orçamento de execução: " + strings.Join(e.Plan.Violations, "; ")
+}
+
+func (e *Executor) checkBudget(plan *PlanSummary) {
+	if e.cfg.MaxPlanCost > 0 && plan.TotalCost > e.cfg.MaxPlanCost {
+		plan.Violations = append(plan.Violations, fmt.Sprintf("custo estimado %.0f acima do limite %.0f", plan.TotalCost, e.cfg.MaxPlanCost))
+	}
+	if e.cfg.MaxPlanRows > 0 && plan.EstimatedRows > e.cfg.MaxPlanRows {
+		plan.Violations = append(plan.Violations, fmt.Sprintf("%.0f linhas estimadas, acima do limite %.0f", plan.EstimatedRows, e.cfg.MaxPlanRows))
+	}
+	if e.cfg.SeqScanMaxTableRows > 0 {
+		for _, scan := range plan.SeqScans {
+			if scan.TableRows > e.cfg.SeqScanMaxTableRows {
+				plan.Violations = append(plan.Violations, fmt.Sprintf("leitura sequencial em %s (%.0f linhas)", scan.Table, scan.TableRows))
+			}
+		}
+	}
+}
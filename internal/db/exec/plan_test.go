@@ -0,0 +1,69 @@
+package exec
+
+import (
+	"rag-sql/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestCheckBudget(t *testing.T) {
+	cfg := config.ExecConfig{MaxPlanCost: 10_000, MaxPlanRows: 5_000, SeqScanMaxTableRows: 100_000}
+
+	tests := []struct {
+		name string
+		cfg  config.ExecConfig
+		plan PlanSummary
+		want []string
+	}{
+		{"dentro do orçamento", cfg, PlanSummary{TotalCost: 9_999, EstimatedRows: 5_000}, nil},
+		{"custo acima", cfg, PlanSummary{TotalCost: 10_001}, []string{"custo estimado 10001 acima do limite 10000"}},
+		{"linhas acima", cfg, PlanSummary{EstimatedRows: 6_000}, []string{"6000 linhas estimadas"}},
+		{
+			"leitura sequencial em tabela grande",
+			cfg,
+			PlanSummary{SeqScans: []SeqScan{{Table: "public.small", TableRows: 50}, {Table: "public.events", TableRows: 2_000_000}}},
+			[]string{"leitura sequencial em public.events"},
+		},
+		{"várias violações", cfg, PlanSummary{TotalCost: 20_000, EstimatedRows: 10_000}, []string{"custo estimado", "linhas estimadas"}},
+		{"limites desligados", config.ExecConfig{}, PlanSummary{TotalCost: 1e9, EstimatedRows: 1e9, SeqScans: []SeqScan{{Table: "t", TableRows: 1e9}}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Executor{cfg: tt.cfg}
+			plan := tt.plan
+			e.checkBudget(&plan)
+			if len(plan.Violations) != len(tt.want) {
+				t.Fatalf("violações = %q, want %d", plan.Violations, len(tt.want))
+			}
+			for i, w := range tt.want {
+				if !strings.Contains(plan.Violations[i], w) {
+					t.Fatalf("violação %d = %q, esperava %q", i, plan.Violations[i], w)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteFullScan(t *testing.T) {
+	tests := []struct {
+		detail string
+		table  string
+		ok     bool
+	}{
+		{"SCAN farms", "farms", true},
+		{"SCAN TABLE farms", "farms", true},
+		{"SCAN farms USING INDEX idx_farms_name", "", false},
+		{"SCAN farms USING COVERING INDEX idx", "", false},
+		{"SEARCH farms USING INTEGER PRIMARY KEY (rowid=?)", "", false},
+		{"SCAN CONSTANT ROW", "", false},
+		{"SCAN SUBQUERY 1", "", false},
+	}
+
+	for _, tt := range tests {
+		table, ok := sqliteFullScan(tt.detail)
+		if table != tt.table || ok != tt.ok {
+			t.Errorf("sqliteFullScan(%q) = %q, %v; want %q, %v", tt.detail, table, ok, tt.table, tt.ok)
+		}
+	}
+}
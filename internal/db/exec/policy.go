@@ -0,0 +1,152 @@
+package exec
+
+import (
+	"fmt"
+	"rag-sql/internal/config"
+	"strings"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type tableRef struct {
+	schema string
+	name   string
+}
+
+// checkPolicy rejeita consultas que tocam tabelas ou colunas ocultas pela
+// política de schema. Quando não dá para saber de qual tabela vem uma
+// coluna, todas as tabelas da consulta são consideradas.
+func (v *Validator) checkPolicy(tree *pg.ParseResult) []Rejection {
+	var rejections []Rejection
+	reject := func(code, format string, args ...any) {
+		rejections = append(rejections, Rejection{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	cteNames := map[string]bool{}
+	aliases := map[string]tableRef{}
+	var tables []tableRef
+	var refs []*pg.ColumnRef
+
+	for _, raw := range tree.Stmts {
+		walk(raw.Stmt, func(m protoreflect.ProtoMessage) {
+			switch n := m.(type) {
+			case *pg.CommonTableExpr:
+				cteNames[strings.ToLower(n.Ctename)] = true
+			case *pg.RangeVar:
+				ref := tableRef{schema: strings.ToLower(n.Schemaname), name: strings.ToLower(n.Relname)}
+				alias := ref.name
+				if n.Alias != nil {
+					alias = strings.ToLower(n.Alias.Aliasname)
+				}
+				aliases[alias] = ref
+				tables = append(tables, ref)
+			case *pg.ColumnRef:
+				refs = append(refs, n)
+			}
+		})
+	}
+
+	var real []tableRef
+	for _, t := range tables {
+		if t.schema == "" && cteNames[t.name] {
+			continue
+		}
+		if t.schema == "" {
+			t.schema = v.defaultSchema
+		}
+		real = append(real, t)
+		if !v.policy.TableVisible(t.schema, t.name) {
+			reject("hidden_table", "tabela não disponível: %s", t.name)
+		}
+	}
+
+	// tabelas citadas como texto não têm as colunas checadas abaixo, então
+	// basta ter colunas ocultas para a referência ser recusada. Um literal
+	// que só tem a forma de nome ('month') pode não ser tabela nenhuma e só é
+	// recusado se a tabela estiver negada explicitamente.
+	denied := config.SchemaPolicy{DenyTables: v.policy.DenyTables}
+	for _, rel := range textRelations(tree) {
+		if rel.rv == nil {
+			if v.policy.Restricted() {
+				reject("hidden_table", "conversões para regclass só são permitidas sobre literais")
+			}
+			continue
+		}
+		schema, name := v.schemaOrDefault(strings.ToLower(rel.rv.Schemaname)), strings.ToLower(rel.rv.Relname)
+		switch {
+		case rel.bare:
+			if !denied.TableVisible(schema, name) {
+				reject("hidden_table", "tabela não disponível: %s", name)
+			}
+		case !v.policy.TableVisible(schema, name):
+			reject("hidden_table", "tabela não disponível: %s", name)
+		case v.policy.HasColumnRestrictions(schema, name):
+			reject("hidden_column", "a tabela %s tem colunas ocultas e não pode ser citada como texto", name)
+		}
+	}
+	if len(rejections) > 0 {
+		return rejections
+	}
+
+	for _, ref := range refs {
+		fields := make([]string, 0, len(ref.Fields))
+		star := false
+		for _, f := range ref.Fields {
+			if f.GetAStar() != nil {
+				star = true
+				continue
+			}
+			fields = append(fields, fieldName(f))
+		}
+
+		candidates := real
+		column := ""
+		switch {
+		case star && len(fields) > 0:
+			candidates = resolveAlias(aliases, cteNames, fields[len(fields)-1])
+		case star:
+		case len(fields) >= 2:
+			candidates = resolveAlias(aliases, cteNames, fields[len(fields)-2])
+			column = fields[len(fields)-1]
+		default:
+			column = fields[0]
+			// uma referência sem coluna pode ser a linha inteira de um alias
+			if t, ok := aliases[column]; ok && v.policy.HasColumnRestrictions(v.schemaOrDefault(t.schema), t.name) {
+				reject("hidden_column", "referência à linha inteira de %s não é permitida; liste as colunas", column)
+				continue
+			}
+		}
+
+		for _, t := range candidates {
+			schema := v.schemaOrDefault(t.schema)
+			if column == "" {
+				if v.policy.HasColumnRestrictions(schema, t.name) {
+					reject("hidden_column", "SELECT * em %s não é permitido; liste as colunas", t.name)
+				}
+				continue
+			}
+			if !v.policy.ColumnVisible(schema, t.name, column) {
+				reject("hidden_column", "coluna não disponível: %s", column)
+				break
+			}
+		}
+	}
+
+	return rejections
+}
+
+func resolveAlias(aliases map[string]tableRef, cteNames map[string]bool, alias string) []tableRef {
+	t, ok := aliases[alias]
+	if !ok || (t.schema == "" && cteNames[t.name]) {
+		return nil
+	}
+	return []tableRef{t}
+}
+
+func (v *Validator) schemaOrDefault(schema string) string {
+	if schema == "" {
+		return v.defaultSchema
+	}
+	return schema
+}
@@ -0,0 +1,65 @@
+package exec
+
+import (
+	"rag-sql/internal/config"
+	"slices"
+	"testing"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	deny := config.SchemaPolicy{
+		DenyTables:  []string{"secret"},
+		DenyColumns: []string{"users.password"},
+	}
+	allow := config.SchemaPolicy{AllowTables: []string{"users", "orders"}}
+
+	tests := []struct {
+		name   string
+		policy config.SchemaPolicy
+		sql    string
+		code   string
+	}{
+		{"tabela permitida", deny, "SELECT id, name FROM users", ""},
+		{"tabela negada", deny, "SELECT * FROM secret", "hidden_table"},
+		{"tabela negada com schema", deny, "SELECT * FROM public.secret", "hidden_table"},
+		{"cte com nome de tabela negada", deny, "WITH secret AS (SELECT 1 AS x) SELECT x FROM secret", ""},
+		{"coluna negada", deny, "SELECT password FROM users", "hidden_column"},
+		{"coluna negada pelo alias", deny, "SELECT u.password FROM users u", "hidden_column"},
+		{"star com coluna negada", deny, "SELECT * FROM users", "hidden_column"},
+		{"linha inteira com coluna negada", deny, "SELECT row_to_json(u) FROM users u", "hidden_column"},
+		{"fora da lista permitida", allow, "SELECT * FROM payments", "hidden_table"},
+		{"consulta em texto", deny, "SELECT query_to_xml('select * from secret', true, false, '')", "hidden_table"},
+		{"consulta em texto aninhada", deny, "SELECT cursor_to_xml('select query_to_xml(''select 1 from secret'', true, false, '''')', 1, true, false, '')", "hidden_table"},
+		{"tabela em texto", deny, "SELECT table_to_xml('secret', true, false, '')", "hidden_table"},
+		{"cast para regclass", deny, "SELECT pg_relation_size('secret'::regclass)", "hidden_table"},
+		{"regclass de expressão", allow, "SELECT pg_relation_size(name::regclass) FROM users", "hidden_table"},
+		{"tabela com colunas ocultas em regclass", deny, "SELECT pg_relation_size('users'::regclass)", "hidden_column"},
+		{"literal que não é tabela", allow, "SELECT date_trunc('month', created_at) FROM orders", ""},
+		{"regclass permitido", allow, "SELECT pg_relation_size('orders'::regclass)", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pg.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := NewValidator(nil, tt.policy, "public")
+			var codes []string
+			for _, r := range v.checkPolicy(tree) {
+				codes = append(codes, r.Code)
+			}
+			if tt.code == "" {
+				if codes != nil {
+					t.Fatalf("esperava aceitar, recusou com %v", codes)
+				}
+				return
+			}
+			if !slices.Contains(codes, tt.code) {
+				t.Fatalf("esperava %s, veio %v", tt.code, codes)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"rag-sql/internal/config"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type postgresBackend struct {
+	db  TxBeginner
+	cfg config.ExecConfig
+}
+
+const (
+	cursorName     = "rag_sql_cursor"
+	fetchBatchSize = 1000
+)
+
+func (p *postgresBackend) begin(ctx context.Context) (*sql.Tx, error) {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao iniciar transação: %w", err)
+	}
+
+	if err := p.applySessionLimits(ctx, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (p *postgresBackend) stream(ctx context.Context, tx *sql.Tx, query string, rs *rowStream) error {
+	// o cursor faz o Postgres produzir só as linhas pedidas em cada lote
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", cursorName, query)); err != nil {
+		return err
+	}
+
+	for {
+		batch := fetchBatchSize
+		if rs.maxRows > 0 {
+			// uma linha a mais indica que o resultado foi truncado
+			batch = min(batch, rs.maxRows-rs.sent+1)
+		}
+
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM %s", batch, cursorName))
+		if err != nil {
+			return err
+		}
+		read, err := rs.scan(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		if rs.truncated || read < batch {
+			return nil
+		}
+	}
+}
+
+// columnNullability lê do catálogo se as colunas das tabelas ("schema.tabela")
+// aceitam nulos, por "schema.tabela.coluna" em minúsculas, já que o lib/pq não
+// informa.
+func (p *postgresBackend) columnNullability(ctx context.Context, tx *sql.Tx, tables []string) (map[string]bool, error) {
+	if len(tables) == 0 {
+		return nil, nil
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT lower(n.nspname) || '.' || lower(c.relname), lower(a.attname), NOT a.attnotnull
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE a.attnum > 0 AND NOT a.attisdropped
+		  AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+		  AND lower(n.nspname) || '.' || lower(c.relname) = ANY($1)`, pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler nulidade das colunas: %w", err)
+	}
+	defer rows.Close()
+
+	nullable := map[string]bool{}
+	for rows.Next() {
+		var table, column string
+		var n bool
+		if err := rows.Scan(&table, &column, &n); err != nil {
+			return nil, err
+		}
+		nullable[table+"."+column] = n
+	}
+	return nullable, rows.Err()
+}
+
+func (p *postgresBackend) applySessionLimits(ctx context.Context, tx *sql.Tx) error {
+	settings := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"statement_timeout", p.cfg.StatementTimeout},
+		{"lock_timeout", p.cfg.LockTimeout},
+		{"idle_in_transaction_session_timeout", p.cfg.IdleInTransactionTimeout},
+	}
+
+	for _, s := range settings {
+		value := s.value
+		// o statement_timeout nunca passa do prazo da requisição, mesmo que o
+		// cancelamento do contexto não chegue ao servidor
+		if deadline, ok := ctx.Deadline(); ok && s.name == "statement_timeout" {
+			if remaining := time.Until(deadline); value <= 0 || remaining < value {
+				value = max(remaining, time.Millisecond)
+			}
+		}
+
+		// set_config(..., true) equivale a SET LOCAL e vale só para esta transação
+		_, err := tx.ExecContext(ctx, `SELECT set_config($1, $2, true)`, s.name, strconv.FormatInt(value.Milliseconds(), 10))
+		if err != nil {
+			return fmt.Errorf("erro ao configurar %s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+type planNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name"`
+	Schema       string     `json:"Schema"`
+	TotalCost    float64    `json:"Total Cost"`
+	PlanRows     float64    `json:"Plan Rows"`
+	Plans        []planNode `json:"Plans"`
+}
+
+func (p *postgresBackend) explain(ctx context.Context, tx *sql.Tx, query string) (*PlanSummary, error) {
+	var raw []byte
+	if err := tx.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON, VERBOSE) "+query).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("erro ao executar EXPLAIN: %w", err)
+	}
+
+	var plans []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plans); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar plano: %w", err)
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("EXPLAIN não retornou plano")
+	}
+
+	root := plans[0].Plan
+	summary := &PlanSummary{
+		TotalCost:     root.TotalCost,
+		EstimatedRows: root.PlanRows,
+	}
+
+	var collect func(n planNode) error
+	collect = func(n planNode) error {
+		if n.NodeType == "Seq Scan" && n.RelationName != "" {
+			table := n.RelationName
+			if n.Schema != "" {
+				table = n.Schema + "." + n.RelationName
+			}
+			tableRows, err := tableRowEstimate(ctx, tx, n.Schema, n.RelationName)
+			if err != nil {
+				return err
+			}
+			summary.SeqScans = append(summary.SeqScans, SeqScan{
+				Table:         table,
+				EstimatedRows: n.PlanRows,
+				TableRows:     tableRows,
+			})
+		}
+		for _, child := range n.Plans {
+			if err := collect(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := collect(root); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+func tableRowEstimate(ctx context.Context, tx *sql.Tx, schema, table string) (float64, error) {
+	var reltuples sql.NullFloat64
+	err := tx.QueryRowContext(ctx, `
+		SELECT c.reltuples
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relname = $1 AND ($2 = '' OR n.nspname = $2)
+		ORDER BY n.nspname = ANY(current_schemas(false)) DESC
+		LIMIT 1
+	`, table, schema).Scan(&reltuples)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("erro ao estimar tamanho de %s: %w", table, err)
+	}
+	// reltuples é -1 para tabelas que nunca passaram por ANALYZE
+	return max(reltuples.Float64, 0), nil
+}
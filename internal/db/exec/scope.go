@@ -0,0 +1,328 @@
+package exec
+
+import (
+	"fmt"
+	"rag-sql/internal/config"
+	"sort"
+	"strings"
+	"sync"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Caller descreve quem está executando a consulta.
+type Caller struct {
+	Role       string
+	Attributes map[string]string
+}
+
+type Scoper struct {
+	scopes map[string]config.TenantScope
+
+	// blocked são as views que leem tabelas com escopo sem ter escopo
+	// próprio, por nome qualificado e só pelo nome
+	mu      sync.RWMutex
+	blocked map[string]bool
+}
+
+func NewScoper(scopes map[string]config.TenantScope) *Scoper {
+	return &Scoper{scopes: scopes}
+}
+
+// UnscopedViews devolve as views de deps (view -> tabelas lidas, nil quando
+// não se sabe) que leem tabelas com escopo de tenant sem ter escopo
+// próprio. A reescrita não as alcança e elas devolveriam as linhas de todos
+// os tenants.
+func (s *Scoper) UnscopedViews(deps map[string][]string) []string {
+	if len(s.scopes) == 0 {
+		return nil
+	}
+
+	var views []string
+	for view, tables := range deps {
+		if _, ok := s.scopeFor(qualifiedRangeVar(view)); ok {
+			continue
+		}
+		scoped := tables == nil
+		for _, t := range tables {
+			if _, ok := s.scopeFor(qualifiedRangeVar(t)); ok {
+				scoped = true
+			}
+		}
+		if scoped {
+			views = append(views, view)
+		}
+	}
+	sort.Strings(views)
+	return views
+}
+
+// Block faz Rewrite recusar as views, substituindo a lista anterior.
+func (s *Scoper) Block(views []string) {
+	blocked := map[string]bool{}
+	for _, v := range views {
+		v = strings.ToLower(v)
+		blocked[v] = true
+		if _, name, ok := strings.Cut(v, "."); ok {
+			blocked[name] = true
+		}
+	}
+	s.mu.Lock()
+	s.blocked = blocked
+	s.mu.Unlock()
+}
+
+func (s *Scoper) isBlocked(rv *pg.RangeVar) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	name := strings.ToLower(rv.Relname)
+	if rv.Schemaname != "" {
+		name = strings.ToLower(rv.Schemaname) + "." + name
+	}
+	return s.blocked[name]
+}
+
+// catalogValueReaders são as visões do catálogo que trazem valores das
+// colunas (valores mais comuns, histogramas), sem passar pela reescrita.
+var catalogValueReaders = map[string]bool{
+	"pg_stats": true, "pg_stats_ext": true, "pg_stats_ext_exprs": true,
+	"pg_statistic": true, "pg_statistic_ext_data": true,
+}
+
+func catalogValueReader(rv *pg.RangeVar) bool {
+	schema := strings.ToLower(rv.Schemaname)
+	return (schema == "" || schema == "pg_catalog") && catalogValueReaders[strings.ToLower(rv.Relname)]
+}
+
+func qualifiedRangeVar(name string) *pg.RangeVar {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return &pg.RangeVar{Schemaname: schema, Relname: table}
+	}
+	return &pg.RangeVar{Relname: name}
+}
+
+// Rewrite troca cada referência a uma tabela com escopo por uma subconsulta
+// filtrada pelo tenant do chamador, inclusive dentro de subconsultas e CTEs.
+// Usar uma subconsulta no lugar do filtro no WHERE preserva a semântica de
+// LEFT/FULL JOIN. Retorna se alguma referência foi reescrita.
+func (s *Scoper) Rewrite(tree *pg.ParseResult, caller Caller) (bool, error) {
+	if len(s.scopes) == 0 {
+		return false, nil
+	}
+
+	var rejections []Rejection
+	reject := func(format string, args ...any) {
+		rejections = append(rejections, Rejection{Code: "tenant_scope", Message: fmt.Sprintf(format, args...)})
+	}
+
+	cteNames := map[string]bool{}
+	var targets []*pg.Node
+	var blocked []*pg.RangeVar
+
+	for _, raw := range tree.Stmts {
+		walk(raw.Stmt, func(m protoreflect.ProtoMessage) {
+			switch n := m.(type) {
+			case *pg.CommonTableExpr:
+				cteNames[strings.ToLower(n.Ctename)] = true
+			case *pg.Node:
+				if rv := n.GetRangeVar(); rv != nil {
+					if catalogValueReader(rv) {
+						reject("o catálogo %s expõe valores das tabelas com escopo de tenant", rv.Relname)
+					}
+					if s.isBlocked(rv) {
+						blocked = append(blocked, rv)
+					}
+					if _, ok := s.scopeFor(rv); ok {
+						targets = append(targets, n)
+					}
+				}
+			}
+		})
+	}
+
+	for _, rv := range blocked {
+		if rv.Schemaname == "" && cteNames[strings.ToLower(rv.Relname)] {
+			continue
+		}
+		reject("a view %s lê tabelas com escopo de tenant e não tem escopo próprio", rv.Relname)
+	}
+
+	// funções que leem uma relação pelo nome não passam pela reescrita
+	for _, rel := range textRelations(tree) {
+		if rel.rv == nil {
+			reject("conversões para regclass só são permitidas sobre literais em consultas com escopo de tenant")
+			continue
+		}
+		if _, ok := s.scopeFor(rel.rv); ok || s.isBlocked(rel.rv) || catalogValueReader(rel.rv) {
+			reject("a tabela %s tem escopo de tenant e não pode ser citada como texto", rel.rv.Relname)
+		}
+	}
+
+	for _, n := range targets {
+		rv := n.GetRangeVar()
+		scope, _ := s.scopeFor(rv)
+
+		if rv.Schemaname == "" && cteNames[strings.ToLower(rv.Relname)] {
+			reject("a CTE %q tem o mesmo nome de uma tabela com escopo de tenant", rv.Relname)
+			continue
+		}
+
+		value, ok := caller.Attributes[scope.Attribute]
+		if !ok || value == "" {
+			reject("a tabela %s exige o atributo de tenant %q, ausente na requisição", rv.Relname, scope.Attribute)
+			continue
+		}
+
+		n.Node = &pg.Node_RangeSubselect{RangeSubselect: scopedSubselect(rv, scope.Column, value)}
+	}
+
+	if len(rejections) > 0 {
+		return false, &ValidationError{Rejections: rejections}
+	}
+	return len(targets) > 0, nil
+}
+
+// textRelation é uma relação citada como texto. rv é nil numa conversão
+// para regclass de algo que não é literal, cuja relação não é conhecida;
+// bare indica um literal que só tem a forma de nome ('pedidos'), que pode ser
+// um texto qualquer passado à função.
+type textRelation struct {
+	rv   *pg.RangeVar
+	bare bool
+}
+
+// textRelations devolve as relações citadas como texto: literais convertidos
+// para regclass e literais passados a funções, que podem nomear uma tabela
+// ou trazer uma consulta inteira.
+func textRelations(tree *pg.ParseResult) []textRelation {
+	var rels []textRelation
+	for _, raw := range tree.Stmts {
+		walk(raw.Stmt, func(m protoreflect.ProtoMessage) {
+			switch n := m.(type) {
+			case *pg.TypeCast:
+				if !isRegclass(n.TypeName) {
+					return
+				}
+				s, ok := stringConst(n.Arg)
+				if !ok {
+					rels = append(rels, textRelation{})
+					return
+				}
+				// aqui o literal é sempre um nome de relação
+				for _, rel := range literalRelations(s) {
+					rel.bare = false
+					rels = append(rels, rel)
+				}
+			case *pg.FuncCall:
+				for _, arg := range n.Args {
+					if named := arg.GetNamedArgExpr(); named != nil {
+						arg = named.Arg
+					}
+					if cast := arg.GetTypeCast(); cast != nil && isRegclass(cast.TypeName) {
+						// já visto como TypeCast
+						continue
+					}
+					if s, ok := stringConst(arg); ok {
+						rels = append(rels, literalRelations(s)...)
+					}
+				}
+			}
+		})
+	}
+	return rels
+}
+
+// literalRelations lê o texto como consulta e, se não for, como nome de
+// tabela, qualificado ou não. Outros textos não citam relações.
+func literalRelations(s string) []textRelation {
+	if tree, err := pg.Parse(s); err == nil && len(tree.Stmts) > 0 {
+		var rels []textRelation
+		for _, raw := range tree.Stmts {
+			walk(raw.Stmt, func(m protoreflect.ProtoMessage) {
+				if rv, ok := m.(*pg.RangeVar); ok {
+					rels = append(rels, textRelation{rv: rv})
+				}
+			})
+		}
+		return append(rels, textRelations(tree)...)
+	}
+
+	tree, err := pg.Parse("SELECT * FROM " + s)
+	if err != nil || len(tree.Stmts) != 1 {
+		return nil
+	}
+	from := tree.Stmts[0].Stmt.GetSelectStmt().GetFromClause()
+	if len(from) != 1 || from[0].GetRangeVar() == nil || from[0].GetRangeVar().Alias != nil {
+		return nil
+	}
+	return []textRelation{{rv: from[0].GetRangeVar(), bare: true}}
+}
+
+func stringConst(n *pg.Node) (string, bool) {
+	for n.GetTypeCast() != nil {
+		n = n.GetTypeCast().Arg
+	}
+	if sval := n.GetAConst().GetSval(); sval != nil {
+		return sval.Sval, true
+	}
+	return "", false
+}
+
+func isRegclass(t *pg.TypeName) bool {
+	if t == nil || len(t.Names) == 0 {
+		return false
+	}
+	return strings.ToLower(t.Names[len(t.Names)-1].GetString_().GetSval()) == "regclass"
+}
+
+func (s *Scoper) scopeFor(rv *pg.RangeVar) (config.TenantScope, bool) {
+	name := strings.ToLower(rv.Relname)
+	schema := strings.ToLower(rv.Schemaname)
+
+	if schema != "" {
+		if scope, ok := s.scopes[schema+"."+name]; ok {
+			return scope, true
+		}
+		if schema != "public" {
+			return config.TenantScope{}, false
+		}
+	}
+	scope, ok := s.scopes[name]
+	return scope, ok
+}
+
+func scopedSubselect(rv *pg.RangeVar, column, value string) *pg.RangeSubselect {
+	alias := rv.Alias
+	if alias == nil {
+		alias = &pg.Alias{Aliasname: rv.Relname}
+	}
+
+	inner := &pg.RangeVar{
+		Catalogname:    rv.Catalogname,
+		Schemaname:     rv.Schemaname,
+		Relname:        rv.Relname,
+		Inh:            rv.Inh,
+		Relpersistence: rv.Relpersistence,
+		Location:       -1,
+	}
+
+	predicate := pg.MakeAExprNode(
+		pg.A_Expr_Kind_AEXPR_OP,
+		[]*pg.Node{pg.MakeStrNode("=")},
+		pg.MakeColumnRefNode([]*pg.Node{pg.MakeStrNode(column)}, -1),
+		pg.MakeAConstStrNode(value, -1),
+		-1,
+	)
+
+	return &pg.RangeSubselect{
+		Subquery: &pg.Node{Node: &pg.Node_SelectStmt{SelectStmt: &pg.SelectStmt{
+			TargetList:  []*pg.Node{pg.MakeResTargetNodeWithVal(pg.MakeColumnRefNode([]*pg.Node{pg.MakeAStarNode()}, -1), -1)},
+			FromClause:  []*pg.Node{{Node: &pg.Node_RangeVar{RangeVar: inner}}},
+			WhereClause: predicate,
+			LimitOption: pg.LimitOption_LIMIT_OPTION_DEFAULT,
+			Op:          pg.SetOperation_SETOP_NONE,
+		}}},
+		Alias: alias,
+	}
+}
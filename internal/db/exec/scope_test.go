@@ -0,0 +1,107 @@
+package exec
+
+import (
+	"rag-sql/internal/config"
+	"slices"
+	"strings"
+	"testing"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+)
+
+func TestScoperRewrite(t *testing.T) {
+	scoper := NewScoper(map[string]config.TenantScope{
+		"orders": {Column: "tenant_id", Attribute: "tenant"},
+	})
+	scoper.Block([]string{"public.orders_report"})
+	caller := Caller{Attributes: map[string]string{"tenant": "42"}}
+	filter := "WHERE tenant_id = '42'"
+
+	tests := []struct {
+		name   string
+		sql    string
+		caller Caller
+		// want são trechos esperados no SQL reescrito; reject, parte da
+		// mensagem de recusa
+		want   []string
+		reject string
+	}{
+		{"tabela sem escopo", "SELECT * FROM users", caller, nil, ""},
+		{"tabela com escopo", "SELECT id FROM orders", caller, []string{"FROM (SELECT * FROM orders " + filter + ") orders"}, ""},
+		{"alias preservado", "SELECT o.id FROM public.orders o", caller, []string{"FROM public.orders " + filter + ") o"}, ""},
+		{"subconsulta", "SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)", caller, []string{filter}, ""},
+		{"dentro de cte", "WITH x AS (SELECT * FROM orders) SELECT * FROM x", caller, []string{filter}, ""},
+		{"left join", "SELECT * FROM users u LEFT JOIN orders o ON o.user_id = u.id", caller, []string{"LEFT JOIN (SELECT * FROM orders " + filter + ") o"}, ""},
+		{"aspas no atributo", "SELECT * FROM orders", Caller{Attributes: map[string]string{"tenant": "x' OR '1'='1"}}, []string{`tenant_id = 'x'' OR ''1''=''1'`}, ""},
+		{"sem atributo", "SELECT * FROM orders", Caller{}, nil, "exige o atributo de tenant"},
+		{"cte com nome da tabela", "WITH orders AS (SELECT 1 AS id) SELECT * FROM orders", caller, nil, "mesmo nome de uma tabela com escopo"},
+		{"tabela em texto", "SELECT table_to_xml('orders', true, false, '')", caller, nil, "não pode ser citada como texto"},
+		{"consulta em texto", "SELECT query_to_xml('select * from orders', true, false, '')", caller, nil, "não pode ser citada como texto"},
+		{"ts_stat", "SELECT * FROM ts_stat('select body from public.orders')", caller, nil, "não pode ser citada como texto"},
+		{"cast para regclass", "SELECT pg_relation_size('orders'::regclass)", caller, nil, "não pode ser citada como texto"},
+		{"regclass de expressão", "SELECT pg_relation_size(relname::regclass) FROM pg_class", caller, nil, "conversões para regclass"},
+		{"literal comum", "SELECT date_trunc('month', created_at) FROM users", caller, nil, ""},
+		{"view bloqueada", "SELECT * FROM orders_report", caller, nil, "a view orders_report"},
+		{"view bloqueada com schema", "SELECT * FROM public.orders_report", caller, nil, "a view orders_report"},
+		{"cte com nome da view bloqueada", "WITH orders_report AS (SELECT 1 AS id) SELECT * FROM orders_report", caller, nil, ""},
+		{"estatísticas do catálogo", "SELECT most_common_vals FROM pg_stats WHERE tablename = 'orders'", caller, nil, "o catálogo pg_stats"},
+		{"estatísticas com schema", "SELECT * FROM pg_catalog.pg_stats_ext", caller, nil, "o catálogo pg_stats_ext"},
+		{"estatísticas em texto", "SELECT pg_relation_size('pg_statistic'::regclass)", caller, nil, "não pode ser citada como texto"},
+		{"view bloqueada em texto", "SELECT table_to_xml('orders_report', true, false, '')", caller, nil, "não pode ser citada como texto"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pg.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rewritten, err := scoper.Rewrite(tree, tt.caller)
+			if tt.reject != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.reject) {
+					t.Fatalf("esperava recusa com %q, veio %v", tt.reject, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if rewritten != (len(tt.want) > 0) {
+				t.Fatalf("rewritten = %v", rewritten)
+			}
+			got, err := pg.Deparse(tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Fatalf("esperava %q em %q", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestUnscopedViews(t *testing.T) {
+	scoper := NewScoper(map[string]config.TenantScope{
+		"orders":        {Column: "tenant_id", Attribute: "tenant"},
+		"public.scoped": {Column: "tenant_id", Attribute: "tenant"},
+	})
+	deps := map[string][]string{
+		"public.report":   {"public.orders", "public.users"},
+		"public.users_v":  {"public.users"},
+		"public.scoped":   {"public.orders"},
+		"public.unknown":  nil,
+		"archive.history": {"archive.orders"},
+	}
+
+	got := scoper.UnscopedViews(deps)
+	want := []string{"public.report", "public.unknown"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if views := NewScoper(nil).UnscopedViews(deps); views != nil {
+		t.Fatalf("sem escopos nenhuma view deveria ser bloqueada, veio %v", views)
+	}
+}
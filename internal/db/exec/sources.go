@@ -0,0 +1,569 @@
+package exec
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// origin é uma coluna de tabela de onde vem um valor do resultado. Table vem
+// como "schema.tabela" (só o nome quando o dialeto não tem schema padrão);
+// Column vazio é a linha inteira da tabela (row_to_json(u), SELECT u).
+type origin struct {
+	Table  string
+	Column string
+}
+
+// columnSource descreve uma coluna do resultado. Derived indica que o valor
+// não é a coluna de origem tal qual, mas uma expressão sobre ela; sem
+// origens a coluna não vem de tabela conhecida.
+type columnSource struct {
+	Column  string
+	Origins []origin
+	Derived bool
+}
+
+// columnSources liga as colunas do resultado às colunas das tabelas de
+// onde vêm, atravessando expressões, subconsultas e CTEs. Na dúvida entre
+// várias tabelas, todas entram como origem.
+type columnSources struct {
+	byName map[string]columnSource
+	// wildcard são as tabelas de um *, cujos nomes de coluna só aparecem no
+	// resultado
+	wildcard []string
+	// fallback junta as origens das expressões, para as colunas cujo nome no
+	// resultado não é o previsto (cada dialeto nomeia expressões a seu modo)
+	fallback []origin
+	// outerJoin indica uma junção externa, que pode trazer nulos de colunas
+	// NOT NULL
+	outerJoin bool
+}
+
+func (s *columnSources) lookup(name string) columnSource {
+	name = strings.ToLower(name)
+	if s == nil {
+		return columnSource{Column: name}
+	}
+	if src, ok := s.byName[name]; ok {
+		return src
+	}
+
+	src := columnSource{Column: name}
+	for _, table := range s.wildcard {
+		src.Origins = append(src.Origins, origin{Table: table, Column: name})
+	}
+	if len(s.fallback) > 0 {
+		src.Origins = append(src.Origins, s.fallback...)
+		src.Derived = true
+	}
+	return src
+}
+
+// resolveSources qualifica as tabelas sem schema com defaultSchema.
+func resolveSources(tree *pg.ParseResult, defaultSchema string) *columnSources {
+	sources := &columnSources{byName: map[string]columnSource{}}
+	if len(tree.Stmts) != 1 {
+		return sources
+	}
+
+	walk(tree.Stmts[0].Stmt, func(m protoreflect.ProtoMessage) {
+		if j, ok := m.(*pg.JoinExpr); ok && j.Jointype != pg.JoinType_JOIN_INNER {
+			sources.outerJoin = true
+		}
+	})
+
+	for _, out := range selectOutputs(tree.Stmts[0].Stmt, &sourceScope{defaultSchema: defaultSchema}) {
+		if out.star != nil {
+			sources.wildcard = append(sources.wildcard, out.star...)
+			continue
+		}
+		if out.derived {
+			sources.fallback = append(sources.fallback, out.origins...)
+		}
+		if out.name == "" {
+			continue
+		}
+		// nomes repetidos ficam com as origens de todas as colunas
+		src := sources.byName[out.name]
+		src.Column = out.name
+		src.Origins = append(src.Origins, out.origins...)
+		src.Derived = src.Derived || out.derived
+		sources.byName[out.name] = src
+	}
+	return sources
+}
+
+// tables devolve as tabelas de onde vêm as colunas do resultado.
+func (s *columnSources) tables() []string {
+	var tables []string
+	add := func(origins []origin) {
+		for _, o := range origins {
+			if !slices.Contains(tables, o.Table) {
+				tables = append(tables, o.Table)
+			}
+		}
+	}
+	for _, src := range s.byName {
+		add(src.Origins)
+	}
+	for _, table := range s.wildcard {
+		add([]origin{{Table: table}})
+	}
+	add(s.fallback)
+	return tables
+}
+
+// nullable diz se a coluna do resultado aceita nulos, pelas colunas de origem
+// em catalog ("schema.tabela.coluna" → aceita nulos). Fica nil quando a
+// coluna é uma expressão ou nenhuma origem está no catálogo; com junção
+// externa só o sim é seguro.
+func (s *columnSources) nullable(name string, catalog map[string]bool) *bool {
+	src := s.lookup(name)
+	if src.Derived || len(catalog) == 0 {
+		return nil
+	}
+	found, result := false, false
+	for _, o := range src.Origins {
+		n, ok := catalog[o.Table+"."+o.Column]
+		if !ok {
+			continue
+		}
+		found, result = true, result || n
+	}
+	if !found || (!result && s.outerJoin) {
+		return nil
+	}
+	return &result
+}
+
+// output é uma coluna de um SELECT. star, quando não é nil, representa as
+// colunas de um * sobre essas tabelas.
+type output struct {
+	name    string
+	origins []origin
+	derived bool
+	star    []string
+}
+
+// relation é um item do FROM: uma tabela, as colunas de uma subconsulta ou
+// CTE, ou algo opaco (funções, VALUES) cujas colunas vêm todas de opaque.
+type relation struct {
+	alias   string
+	table   string
+	outputs []output
+	opaque  []origin
+}
+
+type sourceScope struct {
+	parent        *sourceScope
+	ctes          map[string][]output
+	relations     []relation
+	defaultSchema string
+}
+
+func (sc *sourceScope) cte(name string) ([]output, bool) {
+	for ; sc != nil; sc = sc.parent {
+		if outputs, ok := sc.ctes[name]; ok {
+			return outputs, true
+		}
+	}
+	return nil, false
+}
+
+func (sc *sourceScope) find(alias string) (relation, bool) {
+	for ; sc != nil; sc = sc.parent {
+		for _, rel := range sc.relations {
+			if rel.alias == alias {
+				return rel, true
+			}
+		}
+	}
+	return relation{}, false
+}
+
+func selectOutputs(n *pg.Node, parent *sourceScope) []output {
+	stmt := n.GetSelectStmt()
+	if stmt == nil {
+		return nil
+	}
+
+	sc := &sourceScope{parent: parent, ctes: map[string][]output{}}
+	if parent != nil {
+		sc.defaultSchema = parent.defaultSchema
+	}
+	if stmt.WithClause != nil {
+		for _, c := range stmt.WithClause.Ctes {
+			cte := c.GetCommonTableExpr()
+			if cte == nil {
+				continue
+			}
+			sc.ctes[strings.ToLower(cte.Ctename)] = renameOutputs(selectOutputs(cte.Ctequery, sc), cte.Aliascolnames)
+		}
+	}
+
+	if stmt.Op != pg.SetOperation_SETOP_NONE {
+		return mergeOutputs(selectOutputs(&pg.Node{Node: &pg.Node_SelectStmt{SelectStmt: stmt.Larg}}, sc),
+			selectOutputs(&pg.Node{Node: &pg.Node_SelectStmt{SelectStmt: stmt.Rarg}}, sc))
+	}
+
+	if len(stmt.ValuesLists) > 0 {
+		var outputs []output
+		for _, list := range stmt.ValuesLists {
+			for i, item := range list.GetList().GetItems() {
+				if i == len(outputs) {
+					outputs = append(outputs, output{name: "column" + strconv.Itoa(i+1), derived: true})
+				}
+				outputs[i].origins = append(outputs[i].origins, exprOrigins(item, sc)...)
+			}
+		}
+		return outputs
+	}
+
+	for _, from := range stmt.FromClause {
+		addFromItem(from, sc)
+	}
+
+	var outputs []output
+	for _, target := range stmt.TargetList {
+		res := target.GetResTarget()
+		if res == nil {
+			continue
+		}
+
+		if ref := res.Val.GetColumnRef(); ref != nil && len(ref.Fields) > 0 {
+			if ref.Fields[len(ref.Fields)-1].GetAStar() != nil {
+				outputs = append(outputs, starOutputs(ref, sc)...)
+				continue
+			}
+			origins, derived := columnOrigins(ref, sc)
+			name := fieldName(ref.Fields[len(ref.Fields)-1])
+			if res.Name != "" {
+				name = strings.ToLower(res.Name)
+			}
+			outputs = append(outputs, output{name: name, origins: origins, derived: derived})
+			continue
+		}
+
+		name := strings.ToLower(res.Name)
+		if name == "" {
+			name = figureColname(res.Val)
+		}
+		outputs = append(outputs, output{name: name, origins: exprOrigins(res.Val, sc), derived: true})
+	}
+	return outputs
+}
+
+func addFromItem(n *pg.Node, sc *sourceScope) {
+	switch {
+	case n.GetRangeVar() != nil:
+		rv := n.GetRangeVar()
+		name := strings.ToLower(rv.Relname)
+		rel := relation{alias: name, table: name}
+		if schema := cmp.Or(rv.Schemaname, sc.defaultSchema); schema != "" {
+			rel.table = strings.ToLower(schema) + "." + name
+		}
+		if rv.Schemaname == "" {
+			if outputs, ok := sc.cte(name); ok {
+				rel = relation{alias: name, outputs: outputs}
+			}
+		}
+		if rv.Alias != nil {
+			rel.alias = strings.ToLower(rv.Alias.Aliasname)
+			if len(rv.Alias.Colnames) > 0 {
+				if rel.table != "" {
+					// os nomes novos não dizem qual coluna da tabela é qual
+					rel = relation{alias: rel.alias, opaque: []origin{{Table: rel.table}}}
+				} else {
+					rel.outputs = renameOutputs(rel.outputs, rv.Alias.Colnames)
+				}
+			}
+		}
+		sc.relations = append(sc.relations, rel)
+	case n.GetRangeSubselect() != nil:
+		sub := n.GetRangeSubselect()
+		rel := relation{outputs: selectOutputs(sub.Subquery, sc)}
+		if sub.Alias != nil {
+			rel.alias = strings.ToLower(sub.Alias.Aliasname)
+			rel.outputs = renameOutputs(rel.outputs, sub.Alias.Colnames)
+		}
+		sc.relations = append(sc.relations, rel)
+	case n.GetJoinExpr() != nil:
+		join := n.GetJoinExpr()
+		before := len(sc.relations)
+		addFromItem(join.Larg, sc)
+		addFromItem(join.Rarg, sc)
+		if join.Alias != nil {
+			rel := relation{alias: strings.ToLower(join.Alias.Aliasname)}
+			for _, side := range sc.relations[before:] {
+				rel.opaque = append(rel.opaque, wholeRow(side)...)
+			}
+			sc.relations = append(sc.relations, rel)
+		}
+	case n.GetRangeTableSample() != nil:
+		addFromItem(n.GetRangeTableSample().Relation, sc)
+	default:
+		// funções e afins: as colunas derivam de tudo que a expressão lê
+		rel := relation{opaque: exprOrigins(n, sc)}
+		if fn := n.GetRangeFunction(); fn != nil && fn.Alias != nil {
+			rel.alias = strings.ToLower(fn.Alias.Aliasname)
+		}
+		sc.relations = append(sc.relations, rel)
+	}
+}
+
+// columnOrigins resolve uma referência a coluna. Uma referência só pelo
+// nome de um alias (row_to_json(u)) é a linha inteira.
+func columnOrigins(ref *pg.ColumnRef, sc *sourceScope) ([]origin, bool) {
+	fields := make([]string, 0, len(ref.Fields))
+	for _, f := range ref.Fields {
+		if f.GetAStar() != nil {
+			// u.* dentro de uma expressão
+			var origins []origin
+			for _, out := range starOutputs(ref, sc) {
+				origins = append(origins, out.origins...)
+				for _, table := range out.star {
+					origins = append(origins, origin{Table: table})
+				}
+			}
+			return origins, true
+		}
+		fields = append(fields, fieldName(f))
+	}
+
+	column := fields[len(fields)-1]
+	if len(fields) >= 2 {
+		alias := fields[len(fields)-2]
+		if rel, ok := sc.find(alias); ok {
+			return columnIn(rel, column)
+		}
+		return []origin{{Table: alias, Column: column}}, false
+	}
+
+	var origins []origin
+	derived := false
+	if rel, ok := sc.find(column); ok {
+		origins = append(origins, wholeRow(rel)...)
+		derived = true
+	}
+	// a coluna vem das relações do nível mais próximo que podem tê-la
+	for level := sc; level != nil; level = level.parent {
+		found := false
+		for _, rel := range level.relations {
+			o, d := columnIn(rel, column)
+			if len(o) > 0 || rel.table != "" {
+				origins = append(origins, o...)
+				derived = derived || d
+				found = true
+			}
+		}
+		if found {
+			break
+		}
+	}
+	return origins, derived
+}
+
+func columnIn(rel relation, column string) ([]origin, bool) {
+	if rel.table != "" {
+		return []origin{{Table: rel.table, Column: column}}, false
+	}
+	if len(rel.opaque) > 0 {
+		return rel.opaque, true
+	}
+
+	var origins []origin
+	derived := false
+	for _, out := range rel.outputs {
+		if out.name == column {
+			origins = append(origins, out.origins...)
+			derived = derived || out.derived
+		}
+	}
+	if len(origins) == 0 {
+		for _, out := range rel.outputs {
+			for _, table := range out.star {
+				origins = append(origins, origin{Table: table, Column: column})
+			}
+		}
+	}
+	return origins, derived
+}
+
+func wholeRow(rel relation) []origin {
+	if rel.table != "" {
+		return []origin{{Table: rel.table}}
+	}
+	origins := append([]origin(nil), rel.opaque...)
+	for _, out := range rel.outputs {
+		origins = append(origins, out.origins...)
+		for _, table := range out.star {
+			origins = append(origins, origin{Table: table})
+		}
+	}
+	return origins
+}
+
+// starOutputs expande * ou alias.* nas colunas das relações.
+func starOutputs(ref *pg.ColumnRef, sc *sourceScope) []output {
+	relations := sc.relations
+	if len(ref.Fields) >= 2 {
+		rel, ok := sc.find(fieldName(ref.Fields[len(ref.Fields)-2]))
+		if !ok {
+			return []output{{derived: true}}
+		}
+		relations = []relation{rel}
+	}
+
+	var outputs []output
+	for _, rel := range relations {
+		switch {
+		case rel.table != "":
+			outputs = append(outputs, output{star: []string{rel.table}})
+		case len(rel.opaque) > 0:
+			outputs = append(outputs, output{origins: rel.opaque, derived: true})
+		default:
+			outputs = append(outputs, rel.outputs...)
+		}
+	}
+	return outputs
+}
+
+// exprOrigins junta as origens de todas as colunas lidas pela expressão,
+// inclusive nas subconsultas dentro dela.
+func exprOrigins(n protoreflect.ProtoMessage, sc *sourceScope) []origin {
+	var origins []origin
+	var visit func(m protoreflect.ProtoMessage)
+	visit = func(m protoreflect.ProtoMessage) {
+		switch x := m.(type) {
+		case *pg.ColumnRef:
+			o, _ := columnOrigins(x, sc)
+			origins = append(origins, o...)
+			return
+		case *pg.SubLink:
+			for _, out := range selectOutputs(x.Subselect, sc) {
+				origins = append(origins, out.origins...)
+				for _, table := range out.star {
+					origins = append(origins, origin{Table: table})
+				}
+			}
+			if x.Testexpr != nil {
+				visit(unwrapNode(x.Testexpr))
+			}
+			return
+		}
+		eachChild(m, visit)
+	}
+	visit(unwrapNode(n))
+	return origins
+}
+
+// eachChild chama fn para os filhos diretos da mensagem.
+func eachChild(m protoreflect.ProtoMessage, fn func(protoreflect.ProtoMessage)) {
+	if m == nil {
+		return
+	}
+	msg := m.ProtoReflect()
+	if !msg.IsValid() {
+		return
+	}
+	msg.Range(func(fd protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsMap() {
+			return true
+		}
+		if fd.IsList() {
+			list := val.List()
+			for i := 0; i < list.Len(); i++ {
+				fn(unwrapNode(list.Get(i).Message().Interface()))
+			}
+			return true
+		}
+		fn(unwrapNode(val.Message().Interface()))
+		return true
+	})
+}
+
+// unwrapNode troca o *pg.Node pelo nó concreto, para que os casos do switch
+// de exprOrigins o reconheçam.
+func unwrapNode(m protoreflect.ProtoMessage) protoreflect.ProtoMessage {
+	n, ok := m.(*pg.Node)
+	if !ok {
+		return m
+	}
+	msg := n.ProtoReflect()
+	fd := msg.WhichOneof(msg.Descriptor().Oneofs().ByName("node"))
+	if fd == nil {
+		return m
+	}
+	return msg.Get(fd).Message().Interface()
+}
+
+func mergeOutputs(left, right []output) []output {
+	if len(left) != len(right) {
+		// com * dos dois lados as posições não se correspondem
+		var all []origin
+		for _, out := range right {
+			all = append(all, out.origins...)
+			for _, table := range out.star {
+				all = append(all, origin{Table: table})
+			}
+		}
+		for i := range left {
+			left[i].origins = append(left[i].origins, all...)
+			left[i].derived = true
+		}
+		return left
+	}
+	for i := range left {
+		left[i].origins = append(left[i].origins, right[i].origins...)
+		left[i].derived = left[i].derived || right[i].derived
+		left[i].star = append(left[i].star, right[i].star...)
+	}
+	return left
+}
+
+func renameOutputs(outputs []output, names []*pg.Node) []output {
+	if len(names) == 0 {
+		return outputs
+	}
+	renamed := make([]output, len(outputs))
+	copy(renamed, outputs)
+	for i, n := range names {
+		if i < len(renamed) && renamed[i].star == nil {
+			renamed[i].name = fieldName(n)
+		}
+	}
+	return renamed
+}
+
+// figureColname imita o nome que o Postgres dá a uma coluna sem alias.
+func figureColname(n *pg.Node) string {
+	switch {
+	case n.GetColumnRef() != nil:
+		fields := n.GetColumnRef().Fields
+		return fieldName(fields[len(fields)-1])
+	case n.GetFuncCall() != nil:
+		names := n.GetFuncCall().Funcname
+		return fieldName(names[len(names)-1])
+	case n.GetTypeCast() != nil:
+		if name := figureColname(n.GetTypeCast().Arg); name != "?column?" {
+			return name
+		}
+		names := n.GetTypeCast().TypeName.GetNames()
+		if len(names) > 0 {
+			return fieldName(names[len(names)-1])
+		}
+	case n.GetCaseExpr() != nil:
+		return "case"
+	case n.GetCoalesceExpr() != nil:
+		return "coalesce"
+	}
+	return "?column?"
+}
+
+func fieldName(n *pg.Node) string {
+	return strings.ToLower(n.GetString_().GetSval())
+}
@@ -0,0 +1,142 @@
+package exec
+
+import (
+	"rag-sql/internal/config"
+	"testing"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+)
+
+func TestMaskingLineage(t *testing.T) {
+	policy := config.MaskingPolicy{
+		Columns:       map[string]string{"users.email": MaskHash, "staff.salary": MaskDrop, "*.token": MaskRedact, "public.patients.cpf": MaskDrop},
+		SemanticTypes: map[string]string{"cpf": MaskPartial},
+	}
+	m := NewMasker(config.MaskingConfig{})
+
+	tests := []struct {
+		name   string
+		sql    string
+		column string
+		want   string
+	}{
+		{"coluna direta", "SELECT email FROM users", "email", MaskHash},
+		{"coluna com alias", "SELECT u.email AS contato FROM users u", "contato", MaskHash},
+		{"coluna de outra tabela", "SELECT email FROM leads", "email", ""},
+		{"função sobre a coluna", "SELECT lower(email) FROM users", "lower", MaskHash},
+		{"concatenação", "SELECT email || '' AS e FROM users", "e", MaskHash},
+		{"subconsulta no from", "SELECT x.e FROM (SELECT email AS e FROM users) x", "e", MaskHash},
+		{"cte", "WITH c AS (SELECT email AS e FROM users) SELECT e FROM c", "e", MaskHash},
+		{"cte com nomes de coluna", "WITH c(e) AS (SELECT email FROM users) SELECT e FROM c", "e", MaskHash},
+		{"subconsulta escalar", "SELECT (SELECT email FROM users LIMIT 1) AS e", "e", MaskHash},
+		{"union", "SELECT name AS e FROM leads UNION SELECT email FROM users", "e", MaskHash},
+		{"star", "SELECT * FROM users", "email", MaskHash},
+		{"star do alias", "SELECT u.* FROM users u JOIN orders o ON o.user_id = u.id", "email", MaskHash},
+		{"regra da tabela pelo alias", "SELECT s.salary AS pay FROM staff s", "pay", MaskDrop},
+		{"regra para qualquer tabela", "SELECT token FROM sessions", "token", MaskRedact},
+		// a linha inteira leva a regra mais restritiva que pode valer para a
+		// tabela, com a parcial virando redact
+		{"linha inteira", "SELECT row_to_json(u) AS r FROM users u", "r", MaskRedact},
+		{"linha inteira com regra da tabela", "SELECT s AS r FROM staff s", "r", MaskDrop},
+		{"tipo semântico pelo nome de origem", "SELECT cpf AS doc FROM clients", "doc", MaskPartial},
+		{"linha inteira com tipo semântico", "SELECT c AS r FROM clients c", "r", MaskRedact},
+		{"agregação sem origem mascarada", "SELECT count(*) AS n FROM users", "n", ""},
+		{"coluna comum", "SELECT name FROM users", "name", ""},
+		// regras com schema valem só para a tabela daquele schema
+		{"regra com schema", "SELECT cpf FROM public.patients", "cpf", MaskDrop},
+		{"regra com schema pelo schema padrão", "SELECT cpf FROM patients", "cpf", MaskDrop},
+		{"mesmo nome em outro schema", "SELECT cpf FROM archive.patients", "cpf", MaskPartial},
+		{"regra sem schema em outro schema", "SELECT email FROM archive.users", "email", MaskHash},
+		{"linha inteira em outro schema", "SELECT c AS r FROM archive.patients c", "r", MaskRedact},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pg.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src := resolveSources(tree, "public").lookup(tt.column)
+			if got, _ := m.strategyFor(policy, src, nil); got != tt.want {
+				t.Fatalf("strategyFor = %q, want %q (origens %+v)", got, tt.want, src.Origins)
+			}
+		})
+	}
+}
+
+func TestMaskingByValues(t *testing.T) {
+	policy := config.MaskingPolicy{SemanticTypes: map[string]string{"email": MaskRedact}}
+	m := NewMasker(config.MaskingConfig{})
+	values := []any{"ana@example.com", "bia@example.com", nil}
+
+	strategy, semantic := m.strategyFor(policy, columnSource{Column: "contato"}, values)
+	if strategy != MaskRedact || semantic != "email" {
+		t.Fatalf("got %q/%q, want redact/email", strategy, semantic)
+	}
+}
+
+func TestPartialMask(t *testing.T) {
+	tests := []struct {
+		semantic string
+		in       string
+		want     string
+	}{
+		{"cpf", "123.456.789-09", "***.456.789-**"},
+		{"email", "ana@example.com", "a***@example.com"},
+		// o primeiro caractere inteiro, não o primeiro byte
+		{"email", "élida@example.com", "é***@example.com"},
+		{"phone", "(11) 98765-4321", "*******4321"},
+		{"", "São Paulo", "*****aulo"},
+		{"", "abc", "***"},
+	}
+
+	for _, tt := range tests {
+		if got := partialMask(tt.semantic, tt.in); got != tt.want {
+			t.Errorf("partialMask(%q, %q) = %q, want %q", tt.semantic, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestColumnNullability(t *testing.T) {
+	catalog := map[string]bool{"public.users.email": false, "public.users.name": true, "public.orders.id": false, "archive.users.email": true}
+
+	tests := []struct {
+		name   string
+		sql    string
+		column string
+		want   *bool
+	}{
+		{"not null", "SELECT email FROM users", "email", ptr(false)},
+		{"aceita nulos", "SELECT name FROM users", "name", ptr(true)},
+		{"star", "SELECT * FROM users", "email", ptr(false)},
+		{"expressão", "SELECT lower(email) AS l FROM users", "l", nil},
+		{"junção externa", "SELECT u.email FROM orders o LEFT JOIN users u ON u.id = o.id", "email", nil},
+		{"nulo em junção externa", "SELECT u.name FROM orders o LEFT JOIN users u ON u.id = o.id", "name", ptr(true)},
+		{"fora do catálogo", "SELECT x FROM other", "x", nil},
+		// tabelas de mesmo nome em outro schema não se misturam
+		{"schema explícito", "SELECT email FROM archive.users", "email", ptr(true)},
+		{"schema fora do catálogo", "SELECT name FROM archive.users", "name", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := pg.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := resolveSources(tree, "public").nullable(tt.column, catalog)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Fatalf("got %v, want %v", deref(got), deref(tt.want))
+			}
+		})
+	}
+}
+
+func ptr(b bool) *bool { return &b }
+
+func deref(b *bool) any {
+	if b == nil {
+		return nil
+	}
+	return *b
+}
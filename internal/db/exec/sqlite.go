@@ -0,0 +1,89 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"rag-sql/internal/config"
+	"strings"
+)
+
+// sqliteBackend executa consultas em um arquivo SQLite aberto em modo
+// somente leitura. O SQLite não tem timeouts de sessão; o limite de tempo
+// vem do contexto, que interrompe a consulta em andamento.
+type sqliteBackend struct {
+	db  TxBeginner
+	cfg config.ExecConfig
+}
+
+func (s *sqliteBackend) begin(ctx context.Context) (*sql.Tx, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao iniciar transação: %w", err)
+	}
+	return tx, nil
+}
+
+func (s *sqliteBackend) stream(ctx context.Context, tx *sql.Tx, query string, rs *rowStream) error {
+	if s.cfg.StatementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.StatementTimeout)
+		defer cancel()
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// sem cursor no servidor, a leitura simplesmente para no limite
+	_, err = rs.scan(rows)
+	return err
+}
+
+// explain usa EXPLAIN QUERY PLAN, que não traz custo nem estimativa de
+// linhas. Só as varreduras completas são reportadas, e o nome mostrado pelo
+// SQLite pode ser o alias da tabela.
+func (s *sqliteBackend) explain(ctx context.Context, tx *sql.Tx, query string) (*PlanSummary, error) {
+	rows, err := tx.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao executar EXPLAIN: %w", err)
+	}
+	defer rows.Close()
+
+	summary := &PlanSummary{}
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return nil, fmt.Errorf("erro ao interpretar plano: %w", err)
+		}
+		if table, ok := sqliteFullScan(detail); ok {
+			summary.SeqScans = append(summary.SeqScans, SeqScan{Table: table})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar plano: %w", err)
+	}
+
+	return summary, nil
+}
+
+// sqliteFullScan reconhece linhas como "SCAN farms" ou "SCAN TABLE farms"
+// (versões antigas). Varreduras por índice, subconsultas e linhas
+// constantes não contam.
+func sqliteFullScan(detail string) (string, bool) {
+	fields := strings.Fields(detail)
+	if len(fields) < 2 || fields[0] != "SCAN" || strings.Contains(detail, " USING ") {
+		return "", false
+	}
+	if fields[1] == "TABLE" && len(fields) > 2 {
+		return fields[2], true
+	}
+	switch fields[1] {
+	case "CONSTANT", "SUBQUERY":
+		return "", false
+	}
+	return fields[1], true
+}
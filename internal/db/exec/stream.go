@@ -0,0 +1,104 @@
+package exec
+
+import "database/sql"
+
+// RowWriter recebe o resultado linha a linha. WriteHeader é chamado uma
+// única vez, antes da primeira linha, mesmo quando não há linhas.
+type RowWriter interface {
+	WriteHeader(columns []Column) error
+	WriteRow(row []any) error
+}
+
+// StreamSummary resume uma execução feita com Stream.
+type StreamSummary struct {
+	Plan           *PlanSummary
+	Truncated      bool
+	DroppedColumns []string
+
+	TotalRows          *int64
+	TotalRowsEstimated bool
+}
+
+// rowStream leva as linhas do banco até o RowWriter respeitando o limite,
+// mesmo quando o backend lê o resultado em vários lotes.
+type rowStream struct {
+	w       RowWriter
+	maxRows int
+	// typeOIDs liga o OID do tipo, que só existe no Postgres
+	typeOIDs bool
+	// sources e nullable completam a nulidade que o driver não informa
+	sources   *columnSources
+	nullable  map[string]bool
+	columns   []Column
+	sent      int
+	truncated bool
+}
+
+// scan repassa as linhas de um lote e devolve quantas foram enviadas.
+func (s *rowStream) scan(rows *sql.Rows) (int, error) {
+	if s.columns == nil {
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return 0, err
+		}
+		s.columns = describeColumns(types, s.typeOIDs)
+		for i, col := range s.columns {
+			if col.Nullable == nil {
+				s.columns[i].Nullable = s.sources.nullable(col.Name, s.nullable)
+			}
+		}
+		if err := s.w.WriteHeader(s.columns); err != nil {
+			return 0, err
+		}
+	}
+
+	read := 0
+	for rows.Next() {
+		if s.maxRows > 0 && s.sent == s.maxRows {
+			s.truncated = true
+			break
+		}
+
+		values := make([]any, len(s.columns))
+		pointers := make([]any, len(s.columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return read, err
+		}
+
+		row := make([]any, len(s.columns))
+		for i, col := range s.columns {
+			var err error
+			if row[i], err = decodeValue(col, values[i]); err != nil {
+				return read, err
+			}
+		}
+		if err := s.w.WriteRow(row); err != nil {
+			return read, err
+		}
+		s.sent++
+		read++
+	}
+
+	return read, rows.Err()
+}
+
+// resultCollector junta as linhas em memória para o Execute.
+type resultCollector struct {
+	columns []Column
+	rows    [][]any
+}
+
+func (c *resultCollector) WriteHeader(columns []Column) error {
+	c.columns = columns
+	c.rows = [][]any{}
+	return nil
+}
+
+func (c *resultCollector) WriteRow(row []any) error {
+	c.rows = append(c.rows, row)
+	return nil
+}
@@ -0,0 +1,307 @@
+package exec
+
+import (
+	"fmt"
+	"rag-sql/internal/config"
+	"rag-sql/internal/db/dialect"
+	"strings"
+	"unicode"
+
+	pg "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type Rejection struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Rejections []Rejection `json:"rejections"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Rejections))
+	for _, r := range e.Rejections {
+		msgs = append(msgs, r.Message)
+	}
+	return "consulta rejeitada: " + strings.Join(msgs, "; ")
+}
+
+type Validator struct {
+	deniedFunctions map[string]bool
+	policy          config.SchemaPolicy
+	defaultSchema   string
+}
+
+func NewValidator(deniedFunctions []string, policy config.SchemaPolicy, defaultSchema string) *Validator {
+	denied := make(map[string]bool, len(deniedFunctions))
+	for _, fn := range deniedFunctions {
+		denied[strings.ToLower(fn)] = true
+	}
+	return &Validator{deniedFunctions: denied, policy: policy, defaultSchema: defaultSchema}
+}
+
+// Validate faz o parse com a gramática do Postgres e só aceita um único
+// SELECT sem efeitos colaterais.
+func (v *Validator) Validate(sqlQuery string) (*pg.ParseResult, error) {
+	tree, err := pg.Parse(sqlQuery)
+	if err != nil {
+		return nil, &ValidationError{Rejections: []Rejection{{
+			Code:    "parse_error",
+			Message: fmt.Sprintf("SQL inválido: %v", err),
+		}}}
+	}
+
+	var rejections []Rejection
+	reject := func(code, format string, args ...any) {
+		rejections = append(rejections, Rejection{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch len(tree.Stmts) {
+	case 0:
+		reject("empty_statement", "nenhum comando encontrado")
+	case 1:
+	default:
+		reject("multiple_statements", "apenas um comando é permitido, encontrados %d", len(tree.Stmts))
+	}
+
+	for _, raw := range tree.Stmts {
+		if raw.Stmt.GetSelectStmt() == nil {
+			reject("not_select", "apenas comandos SELECT são permitidos, encontrado %s", nodeName(raw.Stmt))
+		}
+
+		walk(raw.Stmt, func(n protoreflect.ProtoMessage) {
+			switch node := n.(type) {
+			case *pg.InsertStmt, *pg.UpdateStmt, *pg.DeleteStmt, *pg.MergeStmt:
+				reject("data_modifying", "comando de modificação de dados não permitido: %s", typeName(node))
+			case *pg.SelectStmt:
+				if node.IntoClause != nil {
+					reject("select_into", "SELECT ... INTO não é permitido")
+				}
+				if len(node.LockingClause) > 0 {
+					reject("locking_clause", "cláusulas de lock (FOR UPDATE/SHARE) não são permitidas")
+				}
+			case *pg.FuncCall:
+				if name, ok := v.deniedFunction(node); ok {
+					reject("denied_function", "função proibida: %s", name)
+				}
+			}
+		})
+	}
+
+	rejections = append(rejections, v.checkPolicy(tree)...)
+
+	if len(rejections) > 0 {
+		return nil, &ValidationError{Rejections: rejections}
+	}
+	return tree, nil
+}
+
+func (v *Validator) deniedFunction(fn *pg.FuncCall) (string, bool) {
+	var parts []string
+	for _, n := range fn.Funcname {
+		parts = append(parts, strings.ToLower(n.GetString_().GetSval()))
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+
+	qualified := strings.Join(parts, ".")
+	if v.deniedFunctions[qualified] || v.deniedFunctions[parts[len(parts)-1]] {
+		return qualified, true
+	}
+	return "", false
+}
+
+// walk percorre todos os nós da árvore, inclusive subconsultas e CTEs.
+func walk(m protoreflect.ProtoMessage, fn func(protoreflect.ProtoMessage)) {
+	if m == nil {
+		return
+	}
+	msg := m.ProtoReflect()
+	if !msg.IsValid() {
+		return
+	}
+
+	fn(m)
+
+	msg.Range(func(fd protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsMap() {
+			return true
+		}
+		if fd.IsList() {
+			list := val.List()
+			for i := 0; i < list.Len(); i++ {
+				walk(list.Get(i).Message().Interface(), fn)
+			}
+			return true
+		}
+		walk(val.Message().Interface(), fn)
+		return true
+	})
+}
+
+func nodeName(n *pg.Node) string {
+	if n == nil || n.Node == nil {
+		return "comando vazio"
+	}
+	msg := n.ProtoReflect()
+	if fd := msg.WhichOneof(msg.Descriptor().Oneofs().ByName("node")); fd != nil {
+		return string(fd.Message().Name())
+	}
+	return "desconhecido"
+}
+
+func typeName(m protoreflect.ProtoMessage) string {
+	return string(m.ProtoReflect().Descriptor().Name())
+}
+
+// normalizeQuoting troca as aspas de identificadores de outros dialetos
+// (`nome` e, no SQLite, [nome]) por aspas duplas para que a gramática do
+// Postgres aceite a consulta. Literais entre aspas simples não são tocados.
+//
+// Nesses dialetos a consulta original é a executada, então é recusado o que
+// o Postgres lê como comentário ou literal mas o banco lê como SQL: barras
+// invertidas, comentários com # e executáveis do MySQL (/*! */), comentários
+// aninhados, -- sem espaço no MySQL e strings com $. O INTERVAL 7 DAY do
+// MySQL vira INTERVAL '7' DAY só para a análise.
+func normalizeQuoting(dialectName, sqlQuery string) (string, error) {
+	if dialectName == dialect.Postgres {
+		return sqlQuery, nil
+	}
+	mysql := dialectName == dialect.MySQL
+	brackets := dialectName == dialect.SQLite
+
+	reject := func(format string, args ...any) (string, error) {
+		return "", &ValidationError{Rejections: []Rejection{{
+			Code:    "dialect_syntax",
+			Message: fmt.Sprintf(format, args...),
+		}}}
+	}
+
+	src := []rune(sqlQuery)
+	at := func(i int) rune {
+		if i < len(src) {
+			return src[i]
+		}
+		return 0
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(src); i++ {
+		r := src[i]
+		switch {
+		case r == '\\':
+			return reject("barra invertida não é permitida no dialeto %s", dialectName)
+		case r == '#':
+			return reject("o caractere # não é permitido no dialeto %s", dialectName)
+		case r == '$':
+			return reject("o caractere $ não é permitido no dialeto %s", dialectName)
+
+		case r == '\'' || r == '"':
+			// aspas repetidas são a própria aspa nos três dialetos
+			j := i + 1
+			for ; j < len(src); j++ {
+				if src[j] == '\\' {
+					return reject("barra invertida não é permitida no dialeto %s", dialectName)
+				}
+				if src[j] == r {
+					if at(j+1) != r {
+						break
+					}
+					j++
+				}
+			}
+			sb.WriteString(string(src[i:min(j+1, len(src))]))
+			i = j
+
+		case r == '`' || (r == '[' && brackets):
+			end := '`'
+			if r == '[' {
+				end = ']'
+			}
+			j := i + 1
+			for ; j < len(src) && src[j] != end; j++ {
+				// dentro das aspas duplas a aspa fecharia o identificador antes
+				if src[j] == '"' {
+					return reject("aspas duplas dentro de identificador não são permitidas")
+				}
+			}
+			sb.WriteRune('"')
+			sb.WriteString(string(src[i+1 : min(j, len(src))]))
+			if j < len(src) {
+				sb.WriteRune('"')
+			}
+			i = j
+
+		case r == '-' && at(i+1) == '-':
+			// no MySQL "--" só abre comentário seguido de espaço; "--1" é
+			// menos menos um
+			if next := at(i + 2); mysql && next != 0 && !unicode.IsSpace(next) {
+				return reject("comentários -- devem ser seguidos de espaço no dialeto %s", dialectName)
+			}
+			j := i
+			for j < len(src) && src[j] != '\n' {
+				j++
+			}
+			sb.WriteString(string(src[i:j]))
+			i = j - 1
+
+		case r == '/' && at(i+1) == '*':
+			if next := at(i + 2); next == '!' || (next == 'M' && at(i+3) == '!') {
+				return reject("comentários executáveis (/*! */) não são permitidos")
+			}
+			// o Postgres aninha comentários e os outros dialetos não
+			end := strings.Index(string(src[i+2:]), "*/")
+			if end < 0 {
+				return reject("comentário não fechado")
+			}
+			body := string(src[i+2:])[:end]
+			if strings.Contains(body, "/*") {
+				return reject("comentários aninhados não são permitidos no dialeto %s", dialectName)
+			}
+			n := len([]rune(body))
+			sb.WriteString(string(src[i : i+n+4]))
+			i += n + 3
+
+		case mysql && intervalAt(src, i):
+			// INTERVAL 7 DAY é erro de sintaxe no Postgres; INTERVAL '7' DAY
+			// vale nos dois
+			j := i + len("INTERVAL")
+			for j < len(src) && unicode.IsSpace(src[j]) {
+				j++
+			}
+			k := j
+			for k < len(src) && (unicode.IsDigit(src[k]) || src[k] == '.') {
+				k++
+			}
+			sb.WriteString(string(src[i:j]))
+			if k > j && !isIdentRune(at(k)) {
+				sb.WriteString("'" + string(src[j:k]) + "'")
+				j = k
+			}
+			i = j - 1
+
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), nil
+}
+
+// intervalAt indica se a palavra INTERVAL começa na posição i.
+func intervalAt(src []rune, i int) bool {
+	const word = "INTERVAL"
+	if i > 0 && isIdentRune(src[i-1]) || i+len(word) > len(src) {
+		return false
+	}
+	if !strings.EqualFold(string(src[i:i+len(word)]), word) {
+		return false
+	}
+	return i+len(word) == len(src) || !isIdentRune(src[i+len(word)])
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,137 @@
+package exec
+
+import (
+	"errors"
+	"rag-sql/internal/config"
+	"rag-sql/internal/db/dialect"
+	"slices"
+	"testing"
+)
+
+// rejectionCodes devolve os códigos de um *ValidationError, ou nil quando a
+// consulta passou.
+func rejectionCodes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	codes := make([]string, len(ve.Rejections))
+	for i, r := range ve.Rejections {
+		codes[i] = r.Code
+	}
+	return codes
+}
+
+func TestValidate(t *testing.T) {
+	v := NewValidator([]string{"pg_sleep", "table_to_xml", "query_to_xml", "ts_stat", "dblink"}, config.SchemaPolicy{}, "public")
+
+	tests := []struct {
+		name string
+		sql  string
+		code string
+	}{
+		{"select simples", "SELECT id, name FROM users WHERE id = 1", ""},
+		{"cte", "WITH u AS (SELECT id FROM users) SELECT * FROM u", ""},
+		{"sql inválido", "SELEC 1", "parse_error"},
+		{"insert", "INSERT INTO users (id) VALUES (1)", "not_select"},
+		{"vários comandos", "SELECT 1; SELECT 2", "multiple_statements"},
+		{"delete em cte", "WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", "data_modifying"},
+		{"select into", "SELECT * INTO copia FROM users", "select_into"},
+		{"for update", "SELECT * FROM users FOR UPDATE", "locking_clause"},
+		{"função proibida", "SELECT pg_sleep(10)", "denied_function"},
+		{"função proibida com schema", "SELECT pg_catalog.pg_sleep(10)", "denied_function"},
+		{"tabela em texto para xml", "SELECT table_to_xml('orders', true, false, '')", "denied_function"},
+		{"consulta em texto para xml", "SELECT query_to_xml('select * from orders', true, false, '')", "denied_function"},
+		{"ts_stat", "SELECT * FROM ts_stat('select body from orders')", "denied_function"},
+		{"função proibida em subconsulta", "SELECT * FROM users WHERE id IN (SELECT 1 FROM dblink('x', 'y') AS t(a int))", "denied_function"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Validate(tt.sql)
+			codes := rejectionCodes(t, err)
+			if tt.code == "" {
+				if codes != nil {
+					t.Fatalf("esperava aceitar, recusou com %v", codes)
+				}
+				return
+			}
+			if !slices.Contains(codes, tt.code) {
+				t.Fatalf("esperava %s, veio %v", tt.code, codes)
+			}
+		})
+	}
+}
+
+func TestValidateMySQLDateFilters(t *testing.T) {
+	v := NewValidator(nil, config.SchemaPolicy{}, "")
+
+	// as formas que as dicas do dialeto pedem ao modelo
+	for _, sql := range []string{
+		"SELECT id FROM orders WHERE created_at >= NOW() - INTERVAL '7' DAY",
+		"SELECT id FROM orders WHERE created_at >= DATE_SUB(CURDATE(), INTERVAL '1' MONTH)",
+		"SELECT DATE_FORMAT(created_at, '%Y-%m') AS mes, COUNT(*) FROM orders GROUP BY mes",
+		"SELECT id FROM orders WHERE DATE(created_at) = CURDATE() - INTERVAL 1 DAY",
+	} {
+		normalized, err := normalizeQuoting(dialect.MySQL, sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		if _, err := v.Validate(normalized); err != nil {
+			t.Errorf("%s: %v", sql, err)
+		}
+	}
+}
+
+func TestNormalizeQuoting(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		sql     string
+		want    string
+		reject  bool
+	}{
+		{"postgres fica igual", dialect.Postgres, `SELECT "a" FROM t # x`, `SELECT "a" FROM t # x`, false},
+		{"crase do mysql", dialect.MySQL, "SELECT `id` FROM `users`", `SELECT "id" FROM "users"`, false},
+		{"colchete do sqlite", dialect.SQLite, "SELECT [id] FROM [users]", `SELECT "id" FROM "users"`, false},
+		{"crase dentro de literal", dialect.MySQL, "SELECT '`x`' FROM t", "SELECT '`x`' FROM t", false},
+		{"comentário de linha com espaço", dialect.MySQL, "SELECT 1 -- ok\nFROM t", "SELECT 1 -- ok\nFROM t", false},
+		{"comentário executável", dialect.MySQL, "SELECT id FROM t /*!50000 UNION SELECT password FROM users */", "", true},
+		{"comentário executável do mariadb", dialect.MySQL, "SELECT id FROM t /*M! UNION SELECT 1 */", "", true},
+		{"comentário com #", dialect.MySQL, "SELECT id FROM t # UNION\nUNION SELECT password FROM users", "", true},
+		{"-- sem espaço", dialect.MySQL, "SELECT 1 --x\nFROM t", "", true},
+		{"barra invertida em literal", dialect.MySQL, `SELECT 'a\' UNION SELECT password FROM users -- '`, "", true},
+		{"barra invertida no sqlite", dialect.SQLite, `SELECT 'a\'`, "", true},
+		{"aspas duplas dentro de crase", dialect.MySQL, "SELECT `a\"b` FROM t", "", true},
+		{"comentário aninhado", dialect.MySQL, "SELECT 1 /* a /* b */ UNION SELECT 2 */", "", true},
+		{"comentário sem fim", dialect.MySQL, "SELECT 1 /* x", "", true},
+		{"dólar fora de literal", dialect.SQLite, "SELECT $$x$$", "", true},
+		{"intervalo do mysql", dialect.MySQL, "SELECT 1 FROM t WHERE d >= NOW() - INTERVAL 7 DAY", "SELECT 1 FROM t WHERE d >= NOW() - INTERVAL '7' DAY", false},
+		{"intervalo já entre aspas", dialect.MySQL, "SELECT DATE_SUB(d, interval '1' MONTH) FROM t", "SELECT DATE_SUB(d, interval '1' MONTH) FROM t", false},
+		{"intervalo fracionário", dialect.MySQL, "SELECT d + INTERVAL 1.5 HOUR FROM t", "SELECT d + INTERVAL '1.5' HOUR FROM t", false},
+		{"coluna com nome parecido", dialect.MySQL, "SELECT interval_days FROM t", "SELECT interval_days FROM t", false},
+		{"intervalo no sqlite fica igual", dialect.SQLite, "SELECT INTERVAL 7", "SELECT INTERVAL 7", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeQuoting(tt.dialect, tt.sql)
+			if tt.reject {
+				if codes := rejectionCodes(t, err); !slices.Contains(codes, "dialect_syntax") {
+					t.Fatalf("esperava dialect_syntax, veio %v (%q)", codes, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package pii
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	cpfPattern   = regexp.MustCompile(`^\d{3}\.?\d{3}\.?\d{3}-?\d{2}$`)
+	phonePattern = regexp.MustCompile(`^\+?(\d{2}\s?)?\(?\d{2}\)?\s?9?\d{4}-?\d{4}$`)
+)
+
+var nameHints = []struct {
+	semantic string
+	hints    []string
+}{
+	{"email", []string{"email", "e_mail"}},
+	{"cpf", []string{"cpf"}},
+	{"phone", []string{"phone", "telefone", "celular", "fone", "whatsapp"}},
+}
+
+// Detect devolve o tipo semântico da coluna ("email", "cpf" ou "phone") pelo
+// nome ou, quando o nome não diz, pela maioria dos valores; vazio quando não
+// reconhece.
+func Detect(column string, values []any) string {
+	column = strings.ToLower(column)
+	for _, h := range nameHints {
+		for _, hint := range h.hints {
+			if strings.Contains(column, hint) {
+				return h.semantic
+			}
+		}
+	}
+
+	patterns := []struct {
+		semantic string
+		re       *regexp.Regexp
+	}{
+		{"email", emailPattern},
+		{"cpf", cpfPattern},
+		{"phone", phonePattern},
+	}
+
+	for _, p := range patterns {
+		matched, total := 0, 0
+		for _, v := range values {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			total++
+			if p.re.MatchString(strings.TrimSpace(s)) {
+				matched++
+			}
+		}
+		if total > 0 && matched*2 > total {
+			return p.semantic
+		}
+	}
+	return ""
+}
@@ -1,50 +1,72 @@
 package schemautil
 
 import (
-	"regexp"
+	"rag-sql/internal/db/dbschema"
+	"slices"
 	"strings"
 )
 
+// TableRelation guarda a tabela (ou view) e as tabelas que ela referencia,
+// todas como "schema.tabela" quando o schema é conhecido. References traz
+// cada FK com os pares de colunas; ForeignKeys só as tabelas referenciadas.
 type TableRelation struct {
 	Table       string
 	ForeignKeys []string
+	References  []ForeignKey
+}
+
+// ForeignKey é uma aresta do grafo: Columns[i] referencia RefColumns[i].
+// Name fica vazio quando o banco não dá nome à FK.
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	OnDelete   string
 }
 
 type SchemaGraph struct {
 	Relations map[string]TableRelation
 }
 
-func BuildSchemaGraph(schema string) *SchemaGraph {
+// BuildSchemaGraph monta o grafo de relações a partir das FKs do modelo.
+func BuildSchemaGraph(schema *dbschema.Schema) *SchemaGraph {
 	graph := &SchemaGraph{Relations: make(map[string]TableRelation)}
-	tableDefs := strings.Split(schema, "\n\n")
-
-	reTableName := regexp.MustCompile(`(?i)create table (\w+)`)
-	reForeignKey := regexp.MustCompile(`(?i)foreign key.*?references (\w+)`)
-
-	for _, def := range tableDefs {
-		lines := strings.Split(def, "\n")
-		if len(lines) == 0 {
-			continue
-		}
 
-		tableNameMatch := reTableName.FindStringSubmatch(lines[0])
-		if len(tableNameMatch) < 2 {
-			continue
-		}
-		tableName := tableNameMatch[1]
+	for _, t := range schema.Tables {
+		tableName := t.QualifiedName()
 		foreignKeys := []string{}
+		var references []ForeignKey
 
-		for _, line := range lines {
-			if matches := reForeignKey.FindStringSubmatch(line); len(matches) == 2 {
-				foreignKeys = append(foreignKeys, matches[1])
+		for _, fk := range t.ForeignKeys {
+			ref := fk.RefName()
+			if !slices.Contains(foreignKeys, ref) {
+				foreignKeys = append(foreignKeys, ref)
 			}
+			references = append(references, ForeignKey{
+				Name:       fk.Name,
+				Columns:    fk.Columns,
+				RefTable:   ref,
+				RefColumns: fk.RefColumns,
+				OnDelete:   fk.OnDelete,
+			})
 		}
 
 		graph.Relations[tableName] = TableRelation{
 			Table:       tableName,
 			ForeignKeys: foreignKeys,
+			References:  references,
 		}
 	}
 
 	return graph
 }
+
+// SplitQualified separa "schema.tabela"; nomes sem schema voltam com o
+// schema vazio.
+func SplitQualified(name string) (schema, table string) {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return schema, table
+	}
+	return "", name
+}
@@ -0,0 +1,38 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"rag-sql/internal/db/exec"
+)
+
+// csvWriter grava NULL como campo vazio e os demais valores como texto.
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) WriteHeader(columns []exec.Column) error {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	c.record = make([]string, len(columns))
+	return c.w.Write(names)
+}
+
+func (c *csvWriter) WriteRow(row []any) error {
+	for i, v := range row {
+		c.record[i] = toString(v)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"io"
+	"mime"
+	"rag-sql/internal/db/exec"
+	"strings"
+)
+
+// Writer grava o resultado em um formato de arquivo conforme as linhas
+// chegam. Close termina o arquivo e deve ser chamado mesmo sem linhas.
+type Writer interface {
+	exec.RowWriter
+	Close() error
+}
+
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	newWriter   func(w io.Writer) Writer
+}
+
+var formats = []Format{
+	{Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv", newWriter: newCSVWriter},
+	{Name: "ndjson", ContentType: "application/x-ndjson", Extension: "ndjson", newWriter: newNDJSONWriter},
+	{Name: "xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: "xlsx", newWriter: newXLSXWriter},
+	{Name: "parquet", ContentType: "application/vnd.apache.parquet", Extension: "parquet", newWriter: newParquetWriter},
+}
+
+// aliases liga outros tipos MIME usados pelos clientes a um formato.
+var aliases = map[string]string{
+	"text/csv":                "csv",
+	"application/csv":         "csv",
+	"application/jsonl":       "ndjson",
+	"application/x-jsonlines": "ndjson",
+	"application/x-parquet":   "parquet",
+}
+
+func (f Format) NewWriter(w io.Writer) Writer {
+	return f.newWriter(w)
+}
+
+// ByName procura o formato pelo nome usado no parâmetro format.
+func ByName(name string) (Format, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, f := range formats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// FromAccept escolhe o primeiro formato de exportação listado no cabeçalho
+// Accept. JSON e */* não contam, já que JSON é a resposta padrão.
+func FromAccept(accept string) (Format, bool) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if name, ok := aliases[mediaType]; ok {
+			return ByName(name)
+		}
+		for _, f := range formats {
+			if ct, _, _ := mime.ParseMediaType(f.ContentType); ct == mediaType {
+				return f, true
+			}
+		}
+	}
+	return Format{}, false
+}
@@ -0,0 +1,166 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"rag-sql/internal/db/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var (
+	testColumns = []exec.Column{
+		{Name: "id", TypeName: "int4"},
+		{Name: "nome", TypeName: "text"},
+		{Name: "valor", TypeName: "numeric"},
+		{Name: "ativo", TypeName: "bool"},
+		{Name: "criado", TypeName: "timestamptz"},
+		{Name: "tags", TypeName: "text[]"},
+		{Name: "email", TypeName: "text", Masking: exec.MaskHash},
+	}
+	testRows = [][]any{
+		{int64(1), `Ana, "a primeira"`, "12.50", true, "2024-05-01T12:30:00-03:00", []any{"a", "b"}, "9f86d0"},
+		{int64(2), nil, nil, false, nil, nil, nil},
+	}
+)
+
+func export(t *testing.T, name string) []byte {
+	t.Helper()
+	f, ok := ByName(name)
+	if !ok {
+		t.Fatalf("formato %s não encontrado", name)
+	}
+	var buf bytes.Buffer
+	w := f.NewWriter(&buf)
+	if err := w.WriteHeader(testColumns); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range testRows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	want := "id,nome,valor,ativo,criado,tags,email\n" +
+		`1,"Ana, ""a primeira""",12.50,true,2024-05-01T12:30:00-03:00,"[""a"",""b""]",9f86d0` + "\n" +
+		"2,,,false,,,\n"
+	if got := string(export(t, "csv")); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(string(export(t, "ndjson")), "\n"), "\n")
+	if len(lines) != len(testRows) {
+		t.Fatalf("%d linhas, want %d", len(lines), len(testRows))
+	}
+
+	// as chaves seguem a ordem das colunas
+	want := `{"id":1,"nome":"Ana, \"a primeira\"","valor":"12.50","ativo":true,"criado":"2024-05-01T12:30:00-03:00","tags":["a","b"],"email":"9f86d0"}`
+	if lines[0] != want {
+		t.Fatalf("got %s, want %s", lines[0], want)
+	}
+	var second map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if second["nome"] != nil || second["ativo"] != false {
+		t.Fatalf("segunda linha = %v", second)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	f, err := excelize.OpenReader(bytes.NewReader(export(t, "xlsx")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows(xlsxSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows[0], []string{"id", "nome", "valor", "ativo", "criado", "tags", "email"}) {
+		t.Fatalf("cabeçalho = %q", rows[0])
+	}
+	if len(rows) != 3 {
+		t.Fatalf("%d linhas, want 3", len(rows))
+	}
+
+	tests := []struct {
+		cell string
+		typ  excelize.CellType
+		raw  string
+	}{
+		// números ficam sem o atributo de tipo na célula
+		{"A2", excelize.CellTypeUnset, "1"},
+		{"B2", excelize.CellTypeInlineString, `Ana, "a primeira"`},
+		{"C2", excelize.CellTypeUnset, "12.5"},
+		{"D2", excelize.CellTypeBool, "1"},
+		{"F2", excelize.CellTypeInlineString, `["a","b"]`},
+		// o hash mascarado fica texto mesmo parecendo número
+		{"G2", excelize.CellTypeInlineString, "9f86d0"},
+	}
+	for _, tt := range tests {
+		typ, err := f.GetCellType(xlsxSheet, tt.cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := f.GetCellValue(xlsxSheet, tt.cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != tt.typ || raw != tt.raw {
+			t.Errorf("%s = %v %q, want %v %q", tt.cell, typ, raw, tt.typ, tt.raw)
+		}
+	}
+
+	// data/hora com fuso vai em UTC, com o formato de data do Excel
+	raw, err := f.GetCellValue(xlsxSheet, "E2", excelize.Options{RawCellValue: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := excelize.ExcelDateToTime(mustFloat(t, raw), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC); !serial.Equal(want) {
+		t.Fatalf("E2 = %v, want %v", serial, want)
+	}
+}
+
+func mustFloat(t *testing.T, s string) float64 {
+	t.Helper()
+	var f float64
+	if err := json.Unmarshal([]byte(s), &f); err != nil {
+		t.Fatalf("%q não é número: %v", s, err)
+	}
+	return f
+}
+
+func TestFromAccept(t *testing.T) {
+	tests := map[string]string{
+		"text/csv":                         "csv",
+		"application/json, text/csv;q=0.5": "csv",
+		"application/jsonl":                "ndjson",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "xlsx",
+		"application/json": "",
+		"*/*":              "",
+	}
+	for accept, want := range tests {
+		f, ok := FromAccept(accept)
+		if f.Name != want || ok != (want != "") {
+			t.Errorf("FromAccept(%q) = %q, %v; want %q", accept, f.Name, ok, want)
+		}
+	}
+}
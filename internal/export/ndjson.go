@@ -0,0 +1,54 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"rag-sql/internal/db/exec"
+)
+
+// ndjsonWriter grava um objeto JSON por linha, com as chaves na ordem das
+// colunas e os valores com os mesmos tipos da resposta JSON da API.
+type ndjsonWriter struct {
+	w    *bufio.Writer
+	keys [][]byte
+}
+
+func newNDJSONWriter(w io.Writer) Writer {
+	return &ndjsonWriter{w: bufio.NewWriter(w)}
+}
+
+func (n *ndjsonWriter) WriteHeader(columns []exec.Column) error {
+	n.keys = make([][]byte, len(columns))
+	for i, col := range columns {
+		key, err := json.Marshal(col.Name)
+		if err != nil {
+			return err
+		}
+		n.keys[i] = key
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) WriteRow(row []any) error {
+	n.w.WriteByte('{')
+	for i, v := range row {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		n.w.Write(n.keys[i])
+		n.w.WriteByte(':')
+
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n.w.Write(value)
+	}
+	n.w.WriteString("}\n")
+	return nil
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
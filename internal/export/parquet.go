@@ -0,0 +1,162 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"rag-sql/internal/db/exec"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRowGroupSize limita quantas linhas ficam em memória antes de cada
+// grupo ser gravado.
+const parquetRowGroupSize = 10_000
+
+// parquetWriter grava todas as colunas como opcionais, com NULL como valor
+// ausente. numeric vai como texto para não perder precisão, já que o tipo
+// informado pelo banco não traz precisão e escala.
+type parquetWriter struct {
+	out    io.Writer
+	writer *parquet.Writer
+	kinds  []kind
+	// leaf é a posição de cada coluna no schema, que o parquet-go ordena
+	// pelo nome
+	leaf []int
+	rows []parquet.Row
+}
+
+func newParquetWriter(w io.Writer) Writer {
+	return &parquetWriter{out: w}
+}
+
+func (p *parquetWriter) WriteHeader(columns []exec.Column) error {
+	group := parquet.Group{}
+	names := make([]string, len(columns))
+	seen := map[string]int{}
+
+	p.kinds = make([]kind, len(columns))
+	for i, col := range columns {
+		// nomes repetidos (ex.: dois "id" em um JOIN) ganham sufixo
+		name := col.Name
+		if n := seen[col.Name]; n > 0 {
+			name = fmt.Sprintf("%s_%d", col.Name, n+1)
+		}
+		seen[col.Name]++
+		names[i] = name
+
+		p.kinds[i] = kindOf(col)
+		group[name] = parquet.Optional(parquetNode(p.kinds[i]))
+	}
+
+	schema := parquet.NewSchema("resultado", group)
+	position := map[string]int{}
+	for i, path := range schema.Columns() {
+		position[path[0]] = i
+	}
+	p.leaf = make([]int, len(columns))
+	for i, name := range names {
+		p.leaf[i] = position[name]
+	}
+
+	p.writer = parquet.NewWriter(p.out, schema,
+		parquet.Compression(&parquet.Snappy),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+	)
+	return nil
+}
+
+func parquetNode(k kind) parquet.Node {
+	switch k {
+	case kindInt:
+		return parquet.Int(64)
+	case kindFloat:
+		return parquet.Leaf(parquet.DoubleType)
+	case kindBool:
+		return parquet.Leaf(parquet.BooleanType)
+	case kindDate:
+		return parquet.Date()
+	case kindTimestamp:
+		return parquet.TimestampAdjusted(parquet.Microsecond, false)
+	case kindTimestampTZ:
+		return parquet.Timestamp(parquet.Microsecond)
+	case kindJSON:
+		return parquet.JSON()
+	default:
+		return parquet.String()
+	}
+}
+
+func (p *parquetWriter) WriteRow(row []any) error {
+	out := make(parquet.Row, len(row))
+	for i, v := range row {
+		value, err := p.value(p.kinds[i], v)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			out[p.leaf[i]] = value.Level(0, 0, p.leaf[i])
+		} else {
+			out[p.leaf[i]] = value.Level(0, 1, p.leaf[i])
+		}
+	}
+
+	p.rows = append(p.rows, out)
+	if len(p.rows) < parquetRowGroupSize {
+		return nil
+	}
+	return p.flushRows()
+}
+
+// value converte para o tipo físico da coluna. Diferente do XLSX, o schema
+// já foi fixado, então um valor incompatível é erro.
+func (p *parquetWriter) value(k kind, v any) (parquet.Value, error) {
+	if v == nil {
+		return parquet.NullValue(), nil
+	}
+
+	switch k {
+	case kindInt:
+		if n, ok := toInt(v); ok {
+			return parquet.Int64Value(n), nil
+		}
+	case kindFloat:
+		if f, ok := toFloat(v); ok {
+			return parquet.DoubleValue(f), nil
+		}
+	case kindBool:
+		if b, ok := toBool(v); ok {
+			return parquet.BooleanValue(b), nil
+		}
+	case kindDate:
+		if t, ok := toTime(k, v); ok {
+			days := t.Sub(time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)) / (24 * time.Hour)
+			return parquet.Int32Value(int32(days)), nil
+		}
+	case kindTimestamp, kindTimestampTZ:
+		if t, ok := toTime(k, v); ok {
+			return parquet.Int64Value(t.UnixMicro()), nil
+		}
+	default:
+		return parquet.ByteArrayValue([]byte(toString(v))), nil
+	}
+	return parquet.Value{}, fmt.Errorf("valor %v incompatível com o tipo da coluna", v)
+}
+
+func (p *parquetWriter) flushRows() error {
+	if _, err := p.writer.WriteRows(p.rows); err != nil {
+		return err
+	}
+	p.rows = p.rows[:0]
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	if p.writer == nil {
+		return nil
+	}
+	if err := p.flushRows(); err != nil {
+		return err
+	}
+	return p.writer.Close()
+}
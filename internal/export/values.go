@@ -0,0 +1,158 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"rag-sql/internal/db/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kind é a forma como uma coluna é gravada nos formatos tipados (XLSX e
+// Parquet), derivada do tipo informado pelo banco.
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt
+	kindFloat
+	kindDecimal
+	kindBool
+	kindDate
+	kindTimestamp
+	kindTimestampTZ
+	kindJSON
+)
+
+func kindOf(col exec.Column) kind {
+	// valores mascarados viram texto, qualquer que seja o tipo original
+	if col.Masking != "" {
+		return kindString
+	}
+	if strings.HasSuffix(col.TypeName, "[]") {
+		return kindJSON
+	}
+
+	base := strings.TrimPrefix(col.TypeName, "unsigned ")
+	if i := strings.Index(base, "("); i >= 0 {
+		base = base[:i]
+	}
+
+	switch strings.TrimSpace(base) {
+	case "int2", "int4", "int8", "oid", "integer", "int", "bigint", "smallint", "tinyint", "mediumint":
+		return kindInt
+	case "float4", "float8", "real", "double", "double precision", "float":
+		return kindFloat
+	case "numeric", "decimal":
+		return kindDecimal
+	case "bool", "boolean":
+		return kindBool
+	case "date":
+		return kindDate
+	case "timestamp", "datetime":
+		return kindTimestamp
+	case "timestamptz":
+		return kindTimestampTZ
+	case "json", "jsonb":
+		return kindJSON
+	default:
+		return kindString
+	}
+}
+
+// toString é a representação textual usada no CSV e como fallback dos
+// formatos tipados.
+func toString(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case json.RawMessage:
+		return string(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case []any:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprint(val)
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func toInt(v any) (int64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return val, true
+	case float64:
+		if val == float64(int64(val)) {
+			return int64(val), true
+		}
+	case string:
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	case string:
+		// NaN e Infinity chegam como texto e continuam texto
+		if f, err := strconv.ParseFloat(val, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+func toBool(v any) (bool, bool) {
+	switch val := v.(type) {
+	case bool:
+		return val, true
+	case int64:
+		// MySQL e SQLite guardam booleanos como 0/1
+		return val != 0, true
+	}
+	return false, false
+}
+
+// timeLayouts acompanha a formatação feita pelo executor, mais o formato
+// com espaço que o SQLite devolve quando guarda datas como texto.
+var timeLayouts = map[kind][]string{
+	kindDate:        {"2006-01-02"},
+	kindTimestamp:   {"2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", time.RFC3339Nano},
+	kindTimestampTZ: {time.RFC3339Nano},
+}
+
+func toTime(k kind, v any) (time.Time, bool) {
+	switch val := v.(type) {
+	case time.Time:
+		return val, true
+	case string:
+		for _, layout := range timeLayouts[k] {
+			if t, err := time.Parse(layout, val); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,129 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"rag-sql/internal/db/exec"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const xlsxSheet = "Resultado"
+
+// xlsxWriter usa o StreamWriter do excelize, que guarda as linhas em um
+// arquivo temporário em vez de montar a planilha em memória. O arquivo só é
+// enviado no Close, porque o XLSX é um zip com o índice no final.
+type xlsxWriter struct {
+	out    io.Writer
+	file   *excelize.File
+	sheet  *excelize.StreamWriter
+	kinds  []kind
+	row    int
+	styles map[kind]int
+	cells  []any
+}
+
+func newXLSXWriter(w io.Writer) Writer {
+	return &xlsxWriter{out: w}
+}
+
+func (x *xlsxWriter) WriteHeader(columns []exec.Column) error {
+	x.file = excelize.NewFile()
+	if err := x.file.SetSheetName("Sheet1", xlsxSheet); err != nil {
+		return err
+	}
+
+	sheet, err := x.file.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		return err
+	}
+	x.sheet = sheet
+
+	header, err := x.file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	// 14 e 22 são os formatos nativos de data e data/hora do Excel
+	date, err := x.file.NewStyle(&excelize.Style{NumFmt: 14})
+	if err != nil {
+		return err
+	}
+	datetime, err := x.file.NewStyle(&excelize.Style{NumFmt: 22})
+	if err != nil {
+		return err
+	}
+	x.styles = map[kind]int{kindDate: date, kindTimestamp: datetime, kindTimestampTZ: datetime}
+
+	x.kinds = make([]kind, len(columns))
+	names := make([]any, len(columns))
+	for i, col := range columns {
+		x.kinds[i] = kindOf(col)
+		names[i] = excelize.Cell{StyleID: header, Value: col.Name}
+	}
+	x.cells = make([]any, len(columns))
+
+	x.row = 1
+	return x.sheet.SetRow("A1", names)
+}
+
+func (x *xlsxWriter) WriteRow(row []any) error {
+	if x.row == excelize.TotalRows {
+		return fmt.Errorf("resultado excede o limite de %d linhas do XLSX", excelize.TotalRows-1)
+	}
+	x.row++
+
+	for i, v := range row {
+		x.cells[i] = x.cell(x.kinds[i], v)
+	}
+
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	return x.sheet.SetRow(cell, x.cells)
+}
+
+// cell converte o valor para o tipo nativo da planilha; o que não converte
+// fica como texto para não perder informação.
+func (x *xlsxWriter) cell(k kind, v any) any {
+	if v == nil {
+		return nil
+	}
+
+	switch k {
+	case kindInt:
+		if n, ok := toInt(v); ok {
+			return n
+		}
+	case kindFloat, kindDecimal:
+		// o Excel só tem double; numeric com mais dígitos perde precisão
+		if f, ok := toFloat(v); ok {
+			return f
+		}
+	case kindBool:
+		if b, ok := toBool(v); ok {
+			return b
+		}
+	case kindDate, kindTimestamp, kindTimestampTZ:
+		if t, ok := toTime(k, v); ok {
+			// o Excel não guarda fuso; data/hora com fuso vai em UTC
+			if k == kindTimestampTZ {
+				t = t.UTC()
+			}
+			return excelize.Cell{StyleID: x.styles[k], Value: t}
+		}
+	}
+	return toString(v)
+}
+
+func (x *xlsxWriter) Close() error {
+	if x.file == nil {
+		return nil
+	}
+	defer x.file.Close()
+
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.out)
+}
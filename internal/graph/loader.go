@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"rag-sql/internal/db/schemautil"
+	"strings"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
@@ -49,21 +50,46 @@ func (g *Neo4jGraph) LoadSchemaGraph(ctx context.Context, graphSchema *schemauti
 
 	for tableName, relation := range graphSchema.Relations {
 		table := tableName
-		fks := relation.ForeignKeys
+		refs := relation.References
 
 		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
-			_, err := tx.Run(ctx, `MERGE (:Entity {name: $name})`, map[string]any{"name": table})
+			// o nó é identificado pelo nome qualificado; schema e tabela ficam
+			// também separados para consultas
+			schema, bare := schemautil.SplitQualified(table)
+			_, err := tx.Run(ctx, `MERGE (e:Entity {name: $name}) SET e.schema = $schema, e.table = $table REMOVE e.stale`,
+				map[string]any{"name": table, "schema": schema, "table": bare})
 			if err != nil {
 				return nil, err
 			}
 
-			for _, fk := range fks {
+			// na ressincronização as FKs removidas não podem ficar no grafo
+			_, err = tx.Run(ctx, `MATCH (:Entity {name: $name})-[r:REFERENCES]->() DELETE r`, map[string]any{"name": table})
+			if err != nil {
+				return nil, err
+			}
+
+			// uma aresta por FK, identificada pelo nome da constraint; a tabela
+			// referenciada pode ainda não ter sido carregada
+			for _, fk := range refs {
+				name := fk.Name
+				if name == "" {
+					name = table + "(" + strings.Join(fk.Columns, ", ") + ")"
+				}
 				_, err := tx.Run(ctx, `
-					MATCH (a:Entity {name: $from}), (b:Entity {name: $to})
-					MERGE (a)-[:REFERENCES]->(b)
-				`, map[string]any{"from": table, "to": fk})
+					MERGE (a:Entity {name: $from})
+					MERGE (b:Entity {name: $to})
+					MERGE (a)-[r:REFERENCES {name: $constraint}]->(b)
+					SET r.columns = $columns, r.ref_columns = $refColumns, r.on_delete = $onDelete
+				`, map[string]any{
+					"from":       table,
+					"to":         fk.RefTable,
+					"constraint": name,
+					"columns":    fk.Columns,
+					"refColumns": fk.RefColumns,
+					"onDelete":   fk.OnDelete,
+				})
 				if err != nil {
-					return nil, fmt.Errorf("erro ao criar relação de %s para %s: %w", table, fk, err)
+					return nil, fmt.Errorf("erro ao criar relação de %s para %s: %w", table, fk.RefTable, err)
 				}
 			}
 			return nil, nil
@@ -74,9 +100,80 @@ func (g *Neo4jGraph) LoadSchemaGraph(ctx context.Context, graphSchema *schemauti
 		}
 	}
 
+	// tabelas que saíram do schema (nós sem e.table vieram de outras
+	// fontes): as sem aliases são removidas e as demais ficam obsoletas,
+	// para revisão
+	names := make([]string, 0, len(graphSchema.Relations))
+	for tableName := range graphSchema.Relations {
+		names = append(names, tableName)
+	}
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(ctx, `
+			MATCH (e:Entity)
+			WHERE e.table IS NOT NULL AND NOT e.name IN $names AND size(coalesce(e.aliases, [])) = 0
+			DETACH DELETE e
+		`, map[string]any{"names": names})
+		return nil, err
+	})
+	if err == nil {
+		_, err = g.flagStale(ctx, `NOT e.name IN $names`, names)
+	}
+	if err != nil {
+		return fmt.Errorf("falha ao remover entidades antigas: %w", err)
+	}
+
 	return nil
 }
 
+// FlagStaleAliases marca como obsoletas as entidades das tabelas que têm
+// aliases e as devolve. Entidades obsoletas perdem as relações e saem da
+// busca por alias, mas os aliases ficam para revisão até a tabela voltar.
+func (g *Neo4jGraph) FlagStaleAliases(ctx context.Context, tables []string) ([]EntityType, error) {
+	return g.flagStale(ctx, `e.name IN $names`, tables)
+}
+
+func (g *Neo4jGraph) flagStale(ctx context.Context, filter string, names []string) ([]EntityType, error) {
+	session := g.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessMode(neo4j.Write)})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		res, err := tx.Run(ctx, `
+			MATCH (e:Entity)
+			WHERE e.table IS NOT NULL AND `+filter+` AND size(coalesce(e.aliases, [])) > 0
+			SET e.stale = true
+			WITH e
+			OPTIONAL MATCH (e)-[r:REFERENCES]-()
+			DELETE r
+			RETURN DISTINCT e.name AS name, e.aliases AS aliases
+		`, map[string]any{"names": names})
+		if err != nil {
+			return nil, err
+		}
+
+		var stale []EntityType
+		for res.Next(ctx) {
+			record := res.Record()
+			name, _ := record.Get("name")
+			aliases, _ := record.Get("aliases")
+			et := EntityType{}
+			et.Name, _ = name.(string)
+			if list, ok := aliases.([]any); ok {
+				for _, a := range list {
+					if str, ok := a.(string); ok {
+						et.Aliases = append(et.Aliases, str)
+					}
+				}
+			}
+			stale = append(stale, et)
+		}
+		return stale, res.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]EntityType), nil
+}
+
 func (g *Neo4jGraph) AddAliasesToEntity(ctx context.Context, tableName string, aliases []string) error {
 	session := g.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessMode(neo4j.Write)})
 	defer session.Close(ctx)
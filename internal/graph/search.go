@@ -69,6 +69,7 @@ func (g *Neo4jGraph) FindEntitiesByAlias(ctx context.Context, question string) (
 	query := `
 		MATCH (e:Entity)
 		WHERE ANY(alias IN e.aliases WHERE toLower($q) CONTAINS toLower(alias))
+		  AND coalesce(e.stale, false) = false
 		RETURN DISTINCT e.name AS name
 	`
 
@@ -36,7 +36,7 @@ type generateResponse struct {
 
 type Option func(*Client)
 
-func (c *Client) GenerateSQL(prompt string) (string, error) {
+func (c *Client) GenerateSQL(ctx context.Context, prompt string) (string, error) {
 	url := fmt.Sprintf("%s/api/generate", c.Host)
 
 	reqBody, _ := json.Marshal(generateRequest{
@@ -46,7 +46,14 @@ func (c *Client) GenerateSQL(prompt string) (string, error) {
 		Stream: false,
 	})
 
-	resp, err := c.client.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("erro ao criar requisição: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("erro ao chamar LLM: %w", err)
 	}